@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"time"
 
 	k8sApi "k8s.io/kubernetes/pkg/api"
 	k8sApiErr "k8s.io/kubernetes/pkg/api/errors"
@@ -17,9 +18,10 @@ import (
 const (
 	k8sHost               = "127.0.0.1"
 	k8sPort               = "8080"
-	retryOnStatusConflict = 3        // # retries before giving up
-	port                  = "8090"   // webserver port
-	joulesLabelName       = "joules" // name of Kubernetes label assigned to a node
+	retryOnStatusConflict = 3                   // # retries before giving up
+	port                  = "8090"              // webserver port
+	joulesLabelName       = "joules"            // name of Kubernetes label assigned to a node
+	joulesUpdatedAtName   = "joules-updated-at" // unix time in seconds at which the joules label was written
 )
 
 var client *k8sClient.Client
@@ -100,6 +102,7 @@ func updateNode(node k8sApi.Node, joulesString string) error {
 	// Retry on status conflict
 	for i := 0; ; i++ {
 		node.Labels[joulesLabelName] = joulesString
+		node.Labels[joulesUpdatedAtName] = strconv.FormatInt(time.Now().Unix(), 10)
 		// Update node
 		_, updateErr := client.Nodes().Update(&node)
 		if updateErr == nil {
@@ -155,6 +158,7 @@ func reset(w http.ResponseWriter, r *http.Request) {
 			fmt.Printf("Failed to get node '%s', skipping...\n", name)
 		}
 		node.Labels[joulesLabelName] = joules
+		node.Labels[joulesUpdatedAtName] = strconv.FormatInt(time.Now().Unix(), 10)
 		nodeClient.Update(node)
 		fmt.Printf("updated node %s label: %s=%s\n", node.Name, joulesLabelName, joules)
 	}
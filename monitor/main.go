@@ -20,6 +20,7 @@ import (
 
 const (
 	joulesLabelName       = "joules"
+	joulesUpdatedAtName   = "joules-updated-at" // unix time in seconds at which the joules label was written
 	k8sHost               = "127.0.0.1"
 	k8sPort               = "8080"
 	updateInterval        = 10 * time.Second
@@ -135,11 +136,11 @@ func processNode(nodeClient k8sClient.NodeInterface, influx *influx.Client, node
 		fmt.Printf("Could not compute joules for node `%s`: %v\n", name, err)
 		return
 	}
-	newJoulesLabel := fmt.Sprintf("%.2f", newJoules)
-	node.Labels[joulesLabelName] = newJoulesLabel
+	labels := joulesLabels(newJoules, time.Now())
+	setLabels(&node, labels)
 
 	// Send the modified node object on the apiserver
-	err = updateNode(nodeClient, node, newJoulesLabel)
+	err = updateNode(nodeClient, node, labels)
 	if err != nil {
 		fmt.Printf("Error updating node '%v':%v, skipping...\n", name, err)
 		return
@@ -155,8 +156,28 @@ func processNode(nodeClient k8sClient.NodeInterface, influx *influx.Client, node
 	fmt.Printf("Updated joules label for node %s", name)
 }
 
+// joulesLabels returns the joules label and its companion label recording
+// when the joules were computed, so the extender can tell a fresh value from
+// a stale one.
+func joulesLabels(joules float64, now time.Time) map[string]string {
+	return map[string]string{
+		joulesLabelName:     fmt.Sprintf("%.2f", joules),
+		joulesUpdatedAtName: strconv.FormatInt(now.Unix(), 10),
+	}
+}
+
+// setLabels sets labels on a node
+func setLabels(node *k8sApi.Node, labels map[string]string) {
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	for k, v := range labels {
+		node.Labels[k] = v
+	}
+}
+
 // updateNode returns nil if successful and an error otherwise
-func updateNode(nodeClient k8sClient.NodeInterface, node k8sApi.Node, newJoulesLabel string) error {
+func updateNode(nodeClient k8sClient.NodeInterface, node k8sApi.Node, labels map[string]string) error {
 	name := node.Name
 	for i := 0; ; i++ {
 		// Try update
@@ -185,7 +206,7 @@ func updateNode(nodeClient k8sClient.NodeInterface, node k8sApi.Node, newJoulesL
 
 		// Use newer version from API server, chanage labels and try to update again
 		node = *newNode
-		node.Labels[joulesLabelName] = newJoulesLabel
+		setLabels(&node, labels)
 		fmt.Printf("Tried to update status of node %v in retry %d/%d, but encountered status error (%v), retrying", name, i, retryOnStatusConflict, statusErr)
 	}
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/nov1n/kubernetes-heat-scheduling/monitor/pkg/heapster"
 )
@@ -41,3 +43,15 @@ func TestComputeNewJoules(t *testing.T) {
 		t.Errorf("computed negative joules: %v", new)
 	}
 }
+
+func TestJoulesLabels(t *testing.T) {
+	now := time.Date(2016, 6, 3, 14, 58, 0, 0, time.UTC)
+	labels := joulesLabels(1234.5678, now)
+	if labels[joulesLabelName] != "1234.57" {
+		t.Errorf("expected joules label 1234.57, got %v", labels[joulesLabelName])
+	}
+	updatedAt, err := strconv.ParseInt(labels[joulesUpdatedAtName], 10, 64)
+	if err != nil || updatedAt != now.Unix() {
+		t.Errorf("expected updated at label %v, got %v", now.Unix(), labels[joulesUpdatedAtName])
+	}
+}
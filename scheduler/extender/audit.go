@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// decision is a structured record of a single filter or prioritize decision.
+type decision struct {
+	Time       time.Time         `json:"time"`
+	Verb       string            `json:"verb"`
+	Namespace  string            `json:"namespace"`
+	Pod        string            `json:"pod"`
+	FilterMode string            `json:"filterMode,omitempty"`
+	Strategy   string            `json:"strategy,omitempty"`
+	Class      string            `json:"class,omitempty"` // heat class of the pod
+	QOS        string            `json:"qos,omitempty"`   // QoS class of the pod when placement is QoS aware
+	Candidates []candidateEntry  `json:"candidates"`
+	Chosen     []string          `json:"chosen,omitempty"`
+	Scores     map[string]int    `json:"scores,omitempty"`
+	Dropped    map[string]string `json:"dropped,omitempty"`
+	Exempt     *exemption        `json:"exempt,omitempty"` // why heat was bypassed or relaxed for the pod
+	Error      string            `json:"error,omitempty"`
+}
+
+// candidateEntry describes a candidate node of a decision.
+type candidateEntry struct {
+	Node    string   `json:"node"`
+	Group   string   `json:"group,omitempty"` // topology group of the node
+	Joules  *float64 `json:"joules"`          // parsed joules label, nil if missing or invalid
+	Penalty float64  `json:"penalty,omitempty"`
+}
+
+// auditLog keeps the most recent decisions in a ring buffer and optionally
+// appends every decision to a JSONL file.
+type auditLog struct {
+	mu      sync.Mutex // guards the fields below
+	entries []decision // ring buffer, next is the oldest entry once full
+	next    int
+	full    bool
+	path    string   // path of the JSONL file, empty if disabled
+	file    *os.File // open JSONL file
+}
+
+// audit is the audit log shared by all handlers.
+var audit = newAuditLog(1000)
+
+// newAuditLog returns an empty audit log holding at most size decisions.
+func newAuditLog(size int) *auditLog {
+	return &auditLog{entries: make([]decision, size)}
+}
+
+// newDecision returns a decision describing the candidate nodes of a request.
+// The class, filter mode and strategy are the ones applied to the pod, after
+// its class and QoS adjusted the config.
+func newDecision(c *config, verb string, pod *k8sApi.Pod, nodes []candidate) decision {
+	classed := withQOS(withClass(c, pod), pod)
+	d := decision{
+		Time:       time.Now(),
+		Verb:       verb,
+		Namespace:  pod.Namespace,
+		Pod:        pod.Name,
+		Candidates: make([]candidateEntry, 0, len(nodes)),
+		Exempt:     c.Exemptions.match(pod),
+		Class:      classed.class.name,
+	}
+	if c.QOS.Enabled {
+		d.QOS = podQOS(pod)
+	}
+	if verb == verbFilter {
+		d.FilterMode = classed.Filter.Mode
+		d.Strategy = classed.strategy.Name()
+	}
+	for i := range nodes {
+		node := &nodes[i]
+		entry := candidateEntry{Node: node.Name, Group: groupName(c, &node.Node)}
+		if node.err == nil {
+			// copy the joules so the entry does not keep the candidates alive.
+			joules := node.reading.Joules
+			entry.Joules = &joules
+			entry.Penalty = node.penalty
+		}
+		d.Candidates = append(d.Candidates, entry)
+	}
+	return d
+}
+
+// configure resizes the ring buffer, keeping the most recent decisions, and
+// opens the JSONL file at path. An empty path disables the file.
+func (a *auditLog) configure(size int, path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if size != len(a.entries) {
+		kept := a.list()
+		if len(kept) > size {
+			kept = kept[len(kept)-size:]
+		}
+		a.entries = make([]decision, size)
+		copy(a.entries, kept)
+		a.next = len(kept) % size
+		a.full = len(kept) == size
+	}
+
+	if path == a.path {
+		return nil
+	}
+	var file *os.File
+	if path != "" {
+		var err error
+		file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open audit file: %v", err)
+		}
+	}
+	if a.file != nil {
+		a.file.Close()
+	}
+	a.path, a.file = path, file
+	return nil
+}
+
+// record adds a decision to the ring buffer and the JSONL file.
+func (a *auditLog) record(d decision) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries[a.next] = d
+	a.next = (a.next + 1) % len(a.entries)
+	if a.next == 0 {
+		a.full = true
+	}
+
+	if a.file != nil {
+		b, err := json.Marshal(&d)
+		if err == nil {
+			_, err = a.file.Write(append(b, '\n'))
+		}
+		if err != nil {
+			errorf("Error when trying to write decision to %v: %v", a.path, err)
+		}
+	}
+}
+
+// list returns the decisions in the ring buffer from old to new. a.mu must
+// be held.
+func (a *auditLog) list() []decision {
+	if !a.full {
+		return append([]decision{}, a.entries[:a.next]...)
+	}
+	return append(append([]decision{}, a.entries[a.next:]...), a.entries[:a.next]...)
+}
+
+// decisions returns the decisions in the ring buffer from old to new that
+// match the namespace and pod if they are not empty.
+func (a *auditLog) decisions(namespace, pod string) []decision {
+	a.mu.Lock()
+	all := a.list()
+	a.mu.Unlock()
+
+	matching := []decision{}
+	for _, d := range all {
+		if (namespace == "" || d.Namespace == namespace) && (pod == "" || d.Pod == pod) {
+			matching = append(matching, d)
+		}
+	}
+	return matching
+}
+
+// decisionsHandler serves the recorded decisions from old to new. The query
+// parameters namespace and pod select decisions of a pod, limit returns only
+// the most recent decisions.
+func decisionsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	matching := audit.decisions(params.Get("namespace"), params.Get("pod"))
+	if l := params.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			writeJSON(w, http.StatusBadRequest, &errorResponse{Error: fmt.Sprintf("limit must be a non-negative integer, got %q", l)})
+			return
+		}
+		if len(matching) > limit {
+			matching = matching[len(matching)-limit:]
+		}
+	}
+	writeJSON(w, http.StatusOK, matching)
+}
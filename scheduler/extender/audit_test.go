@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// TestAuditLogRing tests that the ring buffer keeps the most recent decisions
+// in order, also after resizing.
+func TestAuditLogRing(t *testing.T) {
+	a := newAuditLog(3)
+	for _, name := range []string{"pod1", "pod2", "pod3", "pod4"} {
+		a.record(decision{Namespace: "default", Pod: name})
+	}
+	expectPods(t, "full", a.decisions("", ""), "pod2", "pod3", "pod4")
+	expectPods(t, "by pod", a.decisions("default", "pod3"), "pod3")
+	expectPods(t, "other namespace", a.decisions("kube-system", ""))
+
+	if err := a.configure(2, ""); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expectPods(t, "shrunk", a.decisions("", ""), "pod3", "pod4")
+
+	if err := a.configure(4, ""); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	a.record(decision{Pod: "pod5"})
+	expectPods(t, "grown", a.decisions("", ""), "pod3", "pod4", "pod5")
+}
+
+// TestAuditLogFile tests that decisions are appended to the JSONL file.
+func TestAuditLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extender-audit")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "decisions.jsonl")
+
+	a := newAuditLog(1)
+	if err := a.configure(1, path); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	a.record(decision{Pod: "pod1"})
+	a.record(decision{Pod: "pod2"})
+	a.configure(1, "")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Errorf("Error opening audit file: %v", err)
+		return
+	}
+	defer f.Close()
+	pods := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		d := decision{}
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Errorf("Error decoding line %q: %v", scanner.Text(), err)
+		}
+		pods = append(pods, d.Pod)
+	}
+	if len(pods) != 2 || pods[0] != "pod1" || pods[1] != "pod2" {
+		t.Errorf("Expected pod1 and pod2 in the audit file but got %v", pods)
+	}
+
+	if err := a.configure(1, filepath.Join(dir, "missing", "decisions.jsonl")); err == nil {
+		t.Errorf("Expected error for a file in a missing directory")
+	}
+}
+
+// TestDecisionsEndpoint tests that filter and prioritize decisions are served
+// at /decisions with the parsed joules and reasons.
+func TestDecisionsEndpoint(t *testing.T) {
+	defer func(a *auditLog) { audit = a }(audit)
+	audit = newAuditLog(10)
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeBand, Band: 5}
+	setConfig(c)
+
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	args := &k8sSchedulerApi.ExtenderArgs{
+		Pod: newPod("web", nil),
+		Nodes: newNodeList(
+			newNode("node1", "50"),
+			newNode("node2", "70"),
+			newNode("node3", ""),
+		),
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Fatalf("Error when trying to convert args to bytes: %v", err)
+	}
+	for _, verb := range []string{"/filter", "/prioritize"} {
+		res, err := http.Post(srv.URL+verb, "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatalf("Error when making post request: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	res, err := http.Get(srv.URL + "/decisions?namespace=default&pod=web&limit=2")
+	if err != nil {
+		t.Fatalf("Error when making get request: %v", err)
+	}
+	defer res.Body.Close()
+	decisions := []decision{}
+	if err := json.NewDecoder(res.Body).Decode(&decisions); err != nil {
+		t.Fatalf("Error decoding decisions: %v", err)
+	}
+	if len(decisions) != 2 {
+		t.Fatalf("Expected 2 decisions but got %v", len(decisions))
+	}
+
+	filter := decisions[0]
+	if filter.Verb != verbFilter || filter.FilterMode != filterModeBand || filter.Strategy != strategyCoolest {
+		t.Errorf("Expected a band filter decision but got %+v", filter)
+	}
+	if len(filter.Candidates) != 3 || filter.Candidates[0].Joules == nil || *filter.Candidates[0].Joules != 50 || filter.Candidates[2].Joules != nil {
+		t.Errorf("Expected candidates with parsed joules but got %+v", filter.Candidates)
+	}
+	if len(filter.Chosen) != 1 || filter.Chosen[0] != "node1" {
+		t.Errorf("Expected node1 to be chosen but got %v", filter.Chosen)
+	}
+	if filter.Dropped["node2"] == "" || filter.Dropped["node3"] == "" {
+		t.Errorf("Expected reasons for dropping node2 and node3 but got %v", filter.Dropped)
+	}
+
+	prioritize := decisions[1]
+	if prioritize.Verb != verbPrioritize || prioritize.Scores["node1"] != maxPriority {
+		t.Errorf("Expected a prioritize decision scoring node1 highest but got %+v", prioritize)
+	}
+
+	res, err = http.Get(srv.URL + "/decisions?limit=x")
+	if err != nil {
+		t.Fatalf("Error when making get request: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit but got %v", res.StatusCode)
+	}
+}
+
+// TestDecisionQOS tests that a decision records the class, filter mode and
+// strategy applied to the pod once QoS adjusted the config.
+func TestDecisionQOS(t *testing.T) {
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeBand, Band: 5}
+	c.strategy = &roundRobinStrategy{k: 2}
+	c.HeatClasses.Classes = warmClasses(100)
+	c.QOS = qosPolicy{Enabled: true, StrictCPU: 2, BestEffortClass: classTolerant}
+
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		class    string
+		mode     string
+		strategy string
+	}{
+		"best effort":      {newPod("web", nil), classTolerant, filterModeBand, strategyRoundRobin},
+		"large guaranteed": {newQOSPod("web", nil, "4", "4", "1Gi", "1Gi"), classNeutral, filterModeCoolest, strategyCoolest},
+		"burstable":        {newPod("web", nil, "1"), classNeutral, filterModeBand, strategyRoundRobin},
+	}
+
+	for desc, tc := range testCases {
+		d := newDecision(c, verbFilter, &tc.pod, nil)
+		if d.Class != tc.class || d.FilterMode != tc.mode || d.Strategy != tc.strategy {
+			t.Errorf("Test case %v: expected class %v, mode %v and strategy %v but got %v, %v and %v",
+				desc, tc.class, tc.mode, tc.strategy, d.Class, d.FilterMode, d.Strategy)
+		}
+	}
+}
+
+// expectPods checks that decisions belong to the given pods in order.
+func expectPods(t *testing.T, desc string, decisions []decision, pods ...string) {
+	if len(decisions) != len(pods) {
+		t.Errorf("Test case %v: expected %v decisions but got %v", desc, len(pods), len(decisions))
+		return
+	}
+	for i, d := range decisions {
+		if d.Pod != pods[i] {
+			t.Errorf("Test case %v: expected decision %v for %v but got %v", desc, i, pods[i], d.Pod)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// defaultPriorityKey is the pod annotation, or label, naming the priority
+	// tier of a pod.
+	defaultPriorityKey = "heat-scheduling/priority"
+	// defaultPriorityTier is the priority tier allowed to exceed the soft
+	// budget.
+	defaultPriorityTier = "high"
+)
+
+// budgetPolicy caps the estimated power of the whole cluster, e.g. to stay
+// below a facility power cap. The estimate is the power of every node, see
+// powerMeter, plus the power of the pods admitted recently, see budgetUsage,
+// and a pod is rejected when its projected power would raise the estimate
+// above the budget. A budget watches the nodes into the node cache, see
+// watchesNodes.
+type budgetPolicy struct {
+	MaxWatts     float64 `json:"maxWatts"`     // soft budget, 0 disables the budget
+	HardMaxWatts float64 `json:"hardMaxWatts"` // budget of pods in the priority tier, 0 lets them exceed the soft budget without limit
+	PriorityKey  string  `json:"priorityKey"`  // pod annotation or label naming the priority tier of a pod, the annotation wins
+	PriorityTier string  `json:"priorityTier"` // priority tier allowed to exceed the soft budget
+}
+
+// budgetEstimate is the estimated power of the cluster a pod is checked
+// against.
+type budgetEstimate struct {
+	ClusterWatts  float64 `json:"clusterWatts"`  // watts of the nodes plus the watts of recently admitted pods
+	AdmittedWatts float64 `json:"admittedWatts"` // watts of recently admitted pods, part of the cluster watts
+	PodWatts      float64 `json:"podWatts"`      // watts the pod is expected to add
+	Budget        float64 `json:"budget"`        // budget that applies to the pod, 0 if unlimited
+	Priority      bool    `json:"priority"`      // whether the pod is in the priority tier
+	Nodes         int     `json:"nodes"`         // number of nodes the estimate covers
+	Metered       int     `json:"metered"`       // number of nodes whose power is known
+}
+
+// powerSample is a reading of the heat source for a node.
+type powerSample struct {
+	joules  float64
+	version string    // version of the reading
+	updated time.Time // time of the reading, or the time it was first seen
+}
+
+// nodePower holds the two most recent readings of a node.
+type nodePower struct {
+	previous, latest powerSample
+	known            bool // whether previous holds a reading
+}
+
+// powerMeter derives the power of nodes from their heat. The monitor writes
+// the joules a node used since it started counting, so the power of a node
+// is the change of its joules between its two most recent readings over the
+// time between them. A node has no power until its heat changed once since
+// the meter first saw it, and readings without a time are timed by when the
+// meter first saw them.
+type powerMeter struct {
+	mu    sync.Mutex            // guards nodes
+	now   func() time.Time      // returns the current time, replaced in tests
+	nodes map[string]*nodePower // readings by node name
+}
+
+// meter is the power meter of the budget.
+var meter = newPowerMeter()
+
+// newPowerMeter returns a meter that has seen no readings.
+func newPowerMeter() *powerMeter {
+	return &powerMeter{now: time.Now, nodes: make(map[string]*nodePower)}
+}
+
+// observe records the reading r of the node with the given name and returns
+// the power of the node in watts and whether it is known. The power is
+// unknown when the joules went down, e.g. because the monitor restarted.
+func (m *powerMeter) observe(name string, r heatReading) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.nodes[name]
+	if !ok {
+		if len(m.nodes) >= maxCachedNodes {
+			m.nodes = make(map[string]*nodePower)
+		}
+		p = &nodePower{latest: m.sample(r)}
+		m.nodes[name] = p
+	} else if r.Version != p.latest.version || (!r.Updated.IsZero() && !r.Updated.Equal(p.latest.updated)) {
+		p.previous, p.latest, p.known = p.latest, m.sample(r), true
+	}
+	if !p.known {
+		return 0, false
+	}
+	seconds := p.latest.updated.Sub(p.previous.updated).Seconds()
+	joules := p.latest.joules - p.previous.joules
+	if seconds <= 0 || joules < 0 {
+		return 0, false
+	}
+	return joules / seconds, true
+}
+
+// sample returns the sample of r. m.mu must be held.
+func (m *powerMeter) sample(r heatReading) powerSample {
+	updated := r.Updated
+	if updated.IsZero() {
+		updated = m.now()
+	}
+	return powerSample{joules: r.Joules, version: r.Version, updated: updated}
+}
+
+// admission records a pod that passed the filter while a budget was set.
+type admission struct {
+	placed time.Time // when the pod passed the filter
+	watts  float64   // power of the pod before it decays
+}
+
+// budgetUsage tracks the power of the pods admitted under the budget until
+// the power of the nodes reflects them. Unlike the reservation ledger it does
+// not need to know the node a pod lands on, so pods passed to the scheduler
+// with several candidate nodes are counted as well. The power of an
+// admission decays linearly to zero over the reservation decay.
+type budgetUsage struct {
+	mu     sync.Mutex           // guards the fields below
+	decay  time.Duration        // time after which an admission no longer adds power
+	now    func() time.Time     // returns the current time, replaced in tests
+	admits map[string]admission // admissions by pod key
+}
+
+// admitted is the budget usage shared by all handlers.
+var admitted = newBudgetUsage(30 * time.Second)
+
+// newBudgetUsage returns an empty budget usage.
+func newBudgetUsage(decay time.Duration) *budgetUsage {
+	return &budgetUsage{
+		decay:  decay,
+		now:    time.Now,
+		admits: make(map[string]admission),
+	}
+}
+
+// configure changes the decay, admissions already made are kept.
+func (u *budgetUsage) configure(decay time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.decay = decay
+}
+
+// admit records that the pod with the given key adds watts to the cluster.
+// A pod admitted again replaces its earlier admission.
+func (u *budgetUsage) admit(key string, watts float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if watts <= 0 {
+		return
+	}
+	u.admits[key] = admission{placed: u.now(), watts: watts}
+}
+
+// watts returns the decayed power of every admission except the one of the
+// pod with the given key, which is being checked again. Admissions that have
+// decayed are dropped.
+func (u *budgetUsage) watts(except string) float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := u.now()
+	total := 0.0
+	for key, a := range u.admits {
+		age := now.Sub(a.placed)
+		if age >= u.decay {
+			delete(u.admits, key)
+			continue
+		}
+		if key != except {
+			total += a.watts * (1 - float64(age)/float64(u.decay))
+		}
+	}
+	return total
+}
+
+// validate returns an error describing the first invalid setting of p.
+func (p budgetPolicy) validate() error {
+	if p.MaxWatts < 0 {
+		return fmt.Errorf("max watts must not be negative, got %v", p.MaxWatts)
+	}
+	if p.HardMaxWatts != 0 && p.HardMaxWatts < p.MaxWatts {
+		return fmt.Errorf("hard max watts must be 0 or at least the max watts of %v, got %v", p.MaxWatts, p.HardMaxWatts)
+	}
+	if p.PriorityKey == "" {
+		return fmt.Errorf("priority key must not be empty")
+	}
+	return nil
+}
+
+// isPriority returns whether pod names the priority tier in its annotation
+// or label.
+func (p budgetPolicy) isPriority(pod *k8sApi.Pod) bool {
+	if p.PriorityTier == "" {
+		return false
+	}
+	tier, ok := pod.Annotations[p.PriorityKey]
+	if !ok {
+		tier = pod.Labels[p.PriorityKey]
+	}
+	return tier == p.PriorityTier
+}
+
+// budgetWatts returns the power pod adds to the cluster, its projected heat
+// or the reservation penalty for pods without projected heat, spread over
+// the projection horizon.
+func budgetWatts(c *config, pod *k8sApi.Pod) (float64, error) {
+	heat, err := c.PodHeat.projectedHeat(pod)
+	if err != nil {
+		return 0, err
+	}
+	if heat == 0 {
+		heat = c.Reservations.Penalty
+	}
+	return heat / c.PodHeat.Horizon.Seconds(), nil
+}
+
+// estimateBudget returns the estimated power of the cluster and of pod. The
+// cluster is covered by the node cache, never by the nodes of the request,
+// which miss the nodes the scheduler dropped before calling the extender, so
+// there is no estimate before the cache is synced. Nodes without heat, with
+// stale heat or with unknown power add nothing. The power of recently
+// admitted pods is added from the budget usage rather than from the
+// reservation ledger, so it is not counted twice.
+func estimateBudget(c *config, pod *k8sApi.Pod) (*budgetEstimate, error) {
+	watts, err := budgetWatts(c, pod)
+	if err != nil {
+		return nil, err
+	}
+	all, synced := cachedNodes.all()
+	if !synced {
+		return nil, errNodeCacheNotSynced
+	}
+	nodes := readCandidates(c, all)
+
+	e := &budgetEstimate{PodWatts: watts, Budget: c.Budget.MaxWatts, Priority: c.Budget.isPriority(pod), Nodes: len(nodes)}
+	if e.Priority {
+		e.Budget = c.Budget.HardMaxWatts
+	}
+	for _, node := range nodes {
+		if node.err != nil || node.reading.Stale {
+			continue
+		}
+		if watts, ok := meter.observe(node.Name, node.reading); ok {
+			e.ClusterWatts += watts
+			e.Metered++
+		}
+	}
+	e.AdmittedWatts = admitted.watts(podKey(pod))
+	e.ClusterWatts += e.AdmittedWatts
+	return e, nil
+}
+
+// admitBudget records the power of pod in the budget usage once it passed
+// the filter. Nothing is recorded without a budget.
+func admitBudget(c *config, pod *k8sApi.Pod) {
+	if c.Budget.MaxWatts == 0 {
+		return
+	}
+	watts, err := budgetWatts(c, pod)
+	if err != nil {
+		return
+	}
+	admitted.admit(podKey(pod), watts)
+}
+
+// filterBudget rejects every node when placing pod would raise the estimated
+// power of the cluster above the budget that applies to it. It returns a map
+// from the name of every rejected node to the reason and an error naming the
+// estimate, the map is empty when the pod fits.
+func filterBudget(c *config, pod *k8sApi.Pod, nodes []candidate) (map[string]string, error) {
+	failed := make(map[string]string)
+	if c.Budget.MaxWatts == 0 {
+		return failed, nil
+	}
+	e, err := estimateBudget(c, pod)
+	if err != nil {
+		return failed, err
+	}
+	if !c.dryRun {
+		clusterWatts.Set(e.ClusterWatts)
+	}
+	if e.Budget == 0 || e.ClusterWatts+e.PodWatts <= e.Budget {
+		if e.Priority && e.ClusterWatts+e.PodWatts > c.Budget.MaxWatts {
+			debugf("Pod %v of priority tier %v exceeds the soft budget of %v watts", pod.Name, c.Budget.PriorityTier, c.Budget.MaxWatts)
+		}
+		return failed, nil
+	}
+
+	kind := "soft"
+	if e.Priority {
+		kind = "hard"
+	}
+	reason := fmt.Sprintf("estimated cluster watts %.2f (%.2f + %.2f from pod) would exceed the %v budget of %v",
+		e.ClusterWatts+e.PodWatts, e.ClusterWatts, e.PodWatts, kind, e.Budget)
+	for _, node := range nodes {
+		failed[node.Name] = reason
+	}
+	if !c.dryRun {
+		budgetRejectedTotal.WithLabelValues(kind).Inc()
+	}
+	return failed, fmt.Errorf("pod would exceed the cluster power budget: %v", reason)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// podWatts is the pod heat annotation of a pod adding 40 watts over the
+// default projection horizon.
+const podWatts = "144000"
+
+// newMeteredNode returns a node with the given joules written at the given
+// unix time.
+func newMeteredNode(name string, joules float64, at int64) k8sApi.Node {
+	node := newNode(name, strconv.FormatFloat(joules, 'f', -1, 64))
+	node.Labels[defaultUpdatedAtKey] = strconv.FormatInt(at, 10)
+	return node
+}
+
+// primeMeter returns a power meter that saw the nodes with the given names
+// at 0 joules at unix time 0.
+func primeMeter(names ...string) *powerMeter {
+	m := newPowerMeter()
+	for _, name := range names {
+		m.observe(name, heatReading{Version: "0", Updated: time.Unix(0, 0)})
+	}
+	return m
+}
+
+// TestPowerMeter tests that the power of a node is the change of its joules
+// between its two most recent readings over the time between them.
+func TestPowerMeter(t *testing.T) {
+	now := time.Unix(140, 0)
+	m := newPowerMeter()
+	m.now = fakeClock(&now)
+
+	steps := []struct {
+		desc     string
+		reading  heatReading
+		expected float64
+		known    bool
+	}{
+		{"first reading", heatReading{Joules: 1000, Version: "1000", Updated: time.Unix(10, 0)}, 0, false},
+		{"new reading", heatReading{Joules: 2000, Version: "2000", Updated: time.Unix(20, 0)}, 100, true},
+		{"same reading", heatReading{Joules: 2000, Version: "2000", Updated: time.Unix(20, 0)}, 100, true},
+		{"new time", heatReading{Joules: 2000, Version: "2000", Updated: time.Unix(30, 0)}, 0, true},
+		{"monitor restart", heatReading{Joules: 10, Version: "10", Updated: time.Unix(40, 0)}, 0, false},
+		{"no time", heatReading{Joules: 510, Version: "510"}, 5, true},
+	}
+	for _, step := range steps {
+		watts, known := m.observe("node1", step.reading)
+		if watts != step.expected || known != step.known {
+			t.Errorf("Step %v: expected %v watts (known %v) but got %v (known %v)", step.desc, step.expected, step.known, watts, known)
+		}
+	}
+}
+
+// TestFilterBudget tests that pods which would raise the estimated cluster
+// power above the budget are rejected and that the priority tier may exceed
+// the soft budget up to the hard budget.
+func TestFilterBudget(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer func(m *powerMeter) { meter = m }(meter)
+	meter = primeMeter("node1", "node2")
+	list := newNodeList(
+		newMeteredNode("node1", 1000, 10),
+		newMeteredNode("node2", 2000, 10),
+		newNode("node3", ""),
+	)
+	cachedNodes.replace(list.Items)
+
+	testCases := map[string]struct {
+		budget   budgetPolicy
+		priority bool
+		exempt   bool
+		expected bool
+		reason   string // part of the reason every node is rejected
+	}{
+		"disabled":          {budgetPolicy{}, false, false, true, ""},
+		"within":            {budgetPolicy{MaxWatts: 350}, false, false, true, ""},
+		"at budget":         {budgetPolicy{MaxWatts: 340}, false, false, true, ""},
+		"above":             {budgetPolicy{MaxWatts: 320}, false, false, false, "340.00 (300.00 + 40.00 from pod) would exceed the soft budget of 320"},
+		"exempt above":      {budgetPolicy{MaxWatts: 320}, false, true, false, "soft budget of 320"},
+		"priority within":   {budgetPolicy{MaxWatts: 320, HardMaxWatts: 350}, true, false, true, ""},
+		"priority above":    {budgetPolicy{MaxWatts: 300, HardMaxWatts: 320}, true, false, false, "hard budget of 320"},
+		"priority no limit": {budgetPolicy{MaxWatts: 100}, true, false, true, ""},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 5000}
+		c.Exemptions = exemptionPolicy{Annotation: true}
+		c.Budget = tc.budget
+		c.Budget.PriorityKey = defaultPriorityKey
+		c.Budget.PriorityTier = defaultPriorityTier
+		pod := newPod("web", map[string]string{podHeatAnnotation: podWatts})
+		if tc.priority {
+			pod.Labels = map[string]string{defaultPriorityKey: defaultPriorityTier}
+		}
+		if tc.exempt {
+			pod.Annotations[podExemptAnnotation] = exemptBypass
+		}
+
+		passed, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+		if got := err == nil && len(passed) > 0; got != tc.expected {
+			t.Errorf("Test case %v: expected the pod to fit %v but got %v (%v)", desc, tc.expected, got, err)
+		}
+		if tc.reason == "" {
+			continue
+		}
+		for _, node := range list.Items {
+			if !strings.Contains(failed[node.Name], tc.reason) {
+				t.Errorf("Test case %v: expected %v to be rejected with %q but got %q", desc, node.Name, tc.reason, failed[node.Name])
+			}
+		}
+	}
+}
+
+// TestEstimateBudget tests that the estimate covers the whole node cache, that
+// there is no estimate before the cache is synced and that pods without
+// projected heat add the reservation penalty over the projection horizon.
+func TestEstimateBudget(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer func(m *powerMeter) { meter = m }(meter)
+	meter = primeMeter("node1", "node2", "node3", "node4")
+
+	c := defaultConfig()
+	c.Budget.MaxWatts = 1000
+	c.Reservations.Penalty = 18000
+	pod := newPod("web", nil)
+
+	if _, err := estimateBudget(c, &pod); err != errNodeCacheNotSynced {
+		t.Errorf("Expected %v before the node cache is synced but got %v", errNodeCacheNotSynced, err)
+	}
+
+	cached := newNodeList()
+	for i, joules := range []float64{1000, 2000, 3000} {
+		cached.Items = append(cached.Items, newMeteredNode("node"+strconv.Itoa(i+1), joules, 10))
+	}
+	cached.Items = append(cached.Items, newNode("node4", ""))
+	cachedNodes.replace(cached.Items)
+	e, err := estimateBudget(c, &pod)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if e.ClusterWatts != 600 || e.Nodes != 4 || e.Metered != 3 || e.PodWatts != 5 {
+		t.Errorf("Expected 600 watts on 3 of 4 nodes plus 5 from the pod but got %+v", e)
+	}
+}
+
+// TestFilterBudgetRisingJoules tests that the budget checks the power of the
+// nodes, which stays flat while the joules they used keep rising.
+func TestFilterBudgetRisingJoules(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer func(m *powerMeter) { meter = m }(meter)
+	meter = primeMeter("node1")
+
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 1e9}
+	c.Budget.MaxWatts = 150
+	pod := newPod("web", map[string]string{podHeatAnnotation: podWatts})
+	for i := int64(1); i <= 5; i++ {
+		list := newNodeList(newMeteredNode("node1", float64(i)*1000, i*10))
+		cachedNodes.replace(list.Items)
+		e, err := estimateBudget(c, &pod)
+		if err != nil || e.ClusterWatts != 100 {
+			t.Errorf("Reading %v: expected 100 watts but got %+v (%v)", i, e, err)
+		}
+		if passed, _, err := filterForPod(c, &pod, readCandidates(c, list.Items)); err != nil || len(passed) != 1 {
+			t.Errorf("Reading %v: expected the pod to fit the budget at %v joules but got %v", i, i*1000, err)
+		}
+	}
+}
+
+// TestFilterBudgetAllNodes tests that the estimate covers every node of the
+// cluster, including nodes the scheduler did not send and nodes dropped above
+// the critical level.
+func TestFilterBudgetAllNodes(t *testing.T) {
+	defer func(n *criticalTracker) { critical = n }(critical)
+	critical = newCriticalTracker()
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer func(m *powerMeter) { meter = m }(meter)
+	meter = primeMeter("node1", "node2", "node3")
+
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 5000}
+	c.Critical = criticalPolicy{MaxJoules: 1500}
+	c.Budget.MaxWatts = 360
+	pod := newPod("web", map[string]string{podHeatAnnotation: podWatts})
+	list := newNodeList(newMeteredNode("node1", 1000, 10), newMeteredNode("node2", 2000, 10))
+	cachedNodes.replace(append(list.Items, newMeteredNode("node3", 500, 10)))
+
+	_, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+	if err == nil {
+		t.Fatalf("Expected the pod to exceed the budget with the heat of the critical node2 and the unsent node3")
+	}
+	for _, node := range list.Items {
+		if !strings.Contains(failed[node.Name], "390.00 (350.00 + 40.00 from pod)") {
+			t.Errorf("Expected %v to be rejected by the budget but got %q", node.Name, failed[node.Name])
+		}
+	}
+}
+
+// TestBudgetUsage tests that admissions add up, decay, replace the earlier
+// admission of the same pod and are not counted against the pod itself.
+func TestBudgetUsage(t *testing.T) {
+	now := time.Unix(0, 0)
+	u := newBudgetUsage(10 * time.Second)
+	u.now = fakeClock(&now)
+
+	u.admit("default/pod1", 20)
+	u.admit("default/pod2", 20)
+	u.admit("default/pod2", 20)
+	u.admit("default/pod3", 0)
+	if w := u.watts(""); w != 40 {
+		t.Errorf("Expected 40 watts after two admissions but got %v", w)
+	}
+	if w := u.watts("default/pod1"); w != 20 {
+		t.Errorf("Expected 20 watts without the admission of pod1 but got %v", w)
+	}
+
+	now = now.Add(5 * time.Second)
+	if w := u.watts(""); w != 20 {
+		t.Errorf("Expected 20 watts after half the decay but got %v", w)
+	}
+
+	now = now.Add(5 * time.Second)
+	if w := u.watts(""); w != 0 {
+		t.Errorf("Expected no watts after the decay but got %v", w)
+	}
+	if len(u.admits) != 0 {
+		t.Errorf("Expected decayed admissions to be dropped but got %v", len(u.admits))
+	}
+}
+
+// TestHandlerBudgetUsage tests that pods passed by the filter count against
+// the budget when several nodes pass and nothing is reserved on a node.
+func TestHandlerBudgetUsage(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer func(u *budgetUsage) { admitted = u }(admitted)
+	admitted = newBudgetUsage(time.Minute)
+	defer func(l *reservations) { ledger = l }(ledger)
+	ledger = newReservations(false, time.Minute)
+	defer func(m *powerMeter) { meter = m }(meter)
+	meter = primeMeter("node1", "node2")
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeBand, Band: 2000}
+	c.Budget.MaxWatts = 370
+	setConfig(c)
+
+	list := newNodeList(newMeteredNode("node1", 1000, 10), newMeteredNode("node2", 2000, 10))
+	cachedNodes.replace(list.Items)
+	testCases := []struct {
+		pod      string
+		expected bool
+	}{
+		{"pod1", true},
+		{"pod2", false},
+		{"pod1", true},
+	}
+
+	for _, tc := range testCases {
+		b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{
+			Pod:   newPod(tc.pod, map[string]string{podHeatAnnotation: podWatts}),
+			Nodes: list,
+		})
+		if err != nil {
+			t.Fatalf("Error when trying to convert args to bytes: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", "/filter", bytes.NewReader(b)))
+		received := &filterResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), received); err != nil {
+			t.Fatalf("Error when trying to decode result %q: %v", rec.Body.String(), err)
+		}
+		if got := received.Error == "" && len(received.Nodes.Items) == 2; got != tc.expected {
+			t.Errorf("Test case %v: expected the pod to pass %v but got %v (%v)", tc.pod, tc.expected, got, received.Error)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// defaultClassKey is the pod annotation, or label, naming the heat class
+	// of a pod.
+	defaultClassKey = "heat-scheduling/class"
+
+	classSensitive = "sensitive" // latency sensitive pods, steered to cool nodes
+	classNeutral   = "neutral"   // pods without a preference, steered to cool nodes
+	classTolerant  = "tolerant"  // throughput pods, steered to warm but safe nodes once a limit is configured
+
+	preferCool = "cool"
+	preferWarm = "warm"
+)
+
+// classPolicy sorts pods into heat classes. Pods of a class preferring warm
+// nodes are steered away from cool nodes, which keeps cool headroom for the
+// pods that need it.
+type classPolicy struct {
+	Key     string               `json:"key"`     // pod annotation or label naming the class, the annotation wins
+	Default string               `json:"default"` // class of pods that name no class or an unknown one
+	Classes map[string]heatClass `json:"classes"` // classes by name
+}
+
+// heatClass holds the thresholds of a heat class. A class preferring warm
+// nodes needs a limit, its own max joules or the critical level, so its pods
+// are not steered to the hottest node of the cluster.
+type heatClass struct {
+	Prefer    string  `json:"prefer"`    // cool or warm, the end of the heat range the class is steered to
+	MaxJoules float64 `json:"maxJoules"` // nodes above this value never pass for pods of the class, 0 disables the limit
+}
+
+// podClass is the heat class of the pod of a request.
+type podClass struct {
+	heatClass
+	name  string
+	named bool // whether the pod names the class itself
+}
+
+// defaultClasses returns the classes known without a config file. Which heat
+// is safe depends on the cluster, so without a config file tolerant pods are
+// steered to cool nodes like the other classes until a limit is set.
+func defaultClasses() map[string]heatClass {
+	return map[string]heatClass{
+		classSensitive: {Prefer: preferCool},
+		classNeutral:   {Prefer: preferCool},
+		classTolerant:  {Prefer: preferCool},
+	}
+}
+
+// validate returns an error describing the first invalid setting of p, given
+// the critical policy of the config.
+func (p classPolicy) validate(critical criticalPolicy) error {
+	if p.Key == "" {
+		return fmt.Errorf("key must not be empty")
+	}
+	if _, ok := p.Classes[p.Default]; !ok {
+		return fmt.Errorf("default class %q is not a class", p.Default)
+	}
+	names := make([]string, 0, len(p.Classes))
+	for name := range p.Classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		class := p.Classes[name]
+		if class.Prefer != preferCool && class.Prefer != preferWarm {
+			return fmt.Errorf("class %v prefers %q, expected %v or %v", name, class.Prefer, preferCool, preferWarm)
+		}
+		if class.MaxJoules < 0 {
+			return fmt.Errorf("class %v has negative max joules %v", name, class.MaxJoules)
+		}
+		if class.Prefer == preferWarm && class.MaxJoules == 0 && critical.MaxJoules == 0 {
+			return fmt.Errorf("class %v prefers %v nodes and needs positive max joules or a critical max joules", name, preferWarm)
+		}
+	}
+	return nil
+}
+
+// classOf returns the heat class of pod, named by its annotation or label.
+// Pods naming an unknown class get the default class.
+func (p classPolicy) classOf(pod *k8sApi.Pod) podClass {
+	name, ok := pod.Annotations[p.Key]
+	if !ok {
+		name, ok = pod.Labels[p.Key]
+	}
+	class, known := p.Classes[name]
+	if ok && known {
+		return podClass{heatClass: class, name: name, named: true}
+	}
+	if ok {
+		errorf("Pod %v names unknown heat class %q, using class %v", pod.Name, name, p.Default)
+	}
+	return podClass{heatClass: p.Classes[p.Default], name: p.Default}
+}
+
+// withClass returns a copy of c that ranks and filters nodes for the heat
+// class of pod.
+func withClass(c *config, pod *k8sApi.Pod) *config {
+	class := c.HeatClasses.classOf(pod)
+	classed := *c
+	classed.class = &class
+	return &classed
+}
+
+// prefersWarm returns whether c steers the pod of a request to warm nodes.
+func (c *config) prefersWarm() bool {
+	return c.class != nil && c.class.Prefer == preferWarm
+}
+
+// filterClass drops the nodes above the max joules of the heat class of c
+// and returns the remaining nodes and a map from the name of every dropped
+// node to the reason it was dropped. Nodes without heat are kept.
+func filterClass(c *config, nodes []candidate) ([]candidate, map[string]string) {
+	failed := make(map[string]string)
+	if c.class == nil || c.class.MaxJoules == 0 {
+		return nodes, failed
+	}
+	passed := make([]candidate, 0, len(nodes))
+	for _, node := range nodes {
+		if joules := node.joules(); joules != math.MaxFloat64 && joules > c.class.MaxJoules {
+			failed[node.Name] = fmt.Sprintf("node joules %v exceed the limit of %v of heat class %v", joules, c.class.MaxJoules, c.class.name)
+			continue
+		}
+		passed = append(passed, node)
+	}
+	return passed, failed
+}
+
+// rankJoules returns the joules nodes are ranked by for the heat class of c.
+// The penalty of recent placements has to make a node less attractive, so it
+// is added for classes preferring cool nodes and subtracted for classes
+// preferring warm nodes, which would otherwise pile onto the node they were
+// placed on last. Nodes without heat have the max float value.
+func rankJoules(c *config, nodes []candidate) []float64 {
+	if !c.prefersWarm() {
+		return candidateJoules(nodes)
+	}
+	joules := make([]float64, len(nodes))
+	for i := range nodes {
+		joules[i] = math.MaxFloat64
+		if nodes[i].err == nil {
+			joules[i] = nodes[i].reading.Joules - nodes[i].penalty
+		}
+	}
+	return joules
+}
+
+// mirrorJoules returns the joules negated, so the limits of the percentile
+// and band modes keep the warm end of the nodes. Nodes without heat keep the
+// max float value.
+func mirrorJoules(joules []float64) []float64 {
+	mirrored := make([]float64, len(joules))
+	for i, j := range joules {
+		mirrored[i] = j
+		if j != math.MaxFloat64 {
+			mirrored[i] = -j
+		}
+	}
+	return mirrored
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// newClassPod returns a pod annotated with a heat class.
+func newClassPod(class string) k8sApi.Pod {
+	return newPod("web", map[string]string{defaultClassKey: class})
+}
+
+// warmClasses returns the default classes with tolerant pods steered to warm
+// nodes below maxJoules.
+func warmClasses(maxJoules float64) map[string]heatClass {
+	classes := defaultClasses()
+	classes[classTolerant] = heatClass{Prefer: preferWarm, MaxJoules: maxJoules}
+	return classes
+}
+
+// TestClassOf tests that the class of a pod is read from its annotation or
+// label and falls back to the default class.
+func TestClassOf(t *testing.T) {
+	labelled := newPod("web", nil)
+	labelled.Labels = map[string]string{defaultClassKey: classTolerant}
+	both := newClassPod(classSensitive)
+	both.Labels = map[string]string{defaultClassKey: classTolerant}
+
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		expected string
+	}{
+		"annotation":      {newClassPod(classTolerant), classTolerant},
+		"label":           {labelled, classTolerant},
+		"annotation wins": {both, classSensitive},
+		"unknown class":   {newClassPod("lukewarm"), classNeutral},
+		"no class":        {newPod("web", nil), classNeutral},
+	}
+
+	p := defaultConfig().HeatClasses
+	for desc, tc := range testCases {
+		if class := p.classOf(&tc.pod); class.name != tc.expected {
+			t.Errorf("Test case %v: expected class %v but got %v", desc, tc.expected, class.name)
+		}
+	}
+}
+
+// TestClassValidate tests that a class preferring warm nodes needs its own
+// limit or the critical level.
+func TestClassValidate(t *testing.T) {
+	testCases := map[string]struct {
+		classMax    float64
+		criticalMax float64
+		valid       bool
+	}{
+		"class limit":    {80, 0, true},
+		"critical limit": {0, 120, true},
+		"both limits":    {80, 120, true},
+		"no limit":       {0, 0, false},
+	}
+
+	for desc, tc := range testCases {
+		p := defaultConfig().HeatClasses
+		p.Classes = warmClasses(tc.classMax)
+		err := p.validate(criticalPolicy{MaxJoules: tc.criticalMax})
+		if tc.valid && err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("Test case %v: expected error", desc)
+		}
+	}
+}
+
+// TestClassFilter tests that tolerant pods are steered to warm nodes below
+// the limit of their class while other pods keep the cool nodes.
+func TestClassFilter(t *testing.T) {
+	list := newNodeList(
+		newNode("node1", "10"),
+		newNode("node2", "40"),
+		newNode("node3", "70"),
+		newNode("node4", "90"),
+		newNode("node5", ""),
+	)
+
+	testCases := map[string]struct {
+		filter   filterPolicy
+		class    string
+		classMax float64
+		expected []string
+		reason   string // part of the reason node1 is rejected, empty if it passes
+	}{
+		"coolest neutral":       {filterPolicy{Mode: filterModeCoolest}, classNeutral, 0, []string{"node1"}, ""},
+		"coolest sensitive":     {filterPolicy{Mode: filterModeCoolest}, classSensitive, 0, []string{"node1"}, ""},
+		"coolest tolerant":      {filterPolicy{Mode: filterModeCoolest}, classTolerant, 100, []string{"node4"}, "not picked"},
+		"coolest tolerant max":  {filterPolicy{Mode: filterModeCoolest}, classTolerant, 80, []string{"node3"}, "not picked"},
+		"coolest sensitive max": {filterPolicy{Mode: filterModeCoolest}, classSensitive, 5, []string{"node5"}, "heat class sensitive"},
+		"percentile neutral":    {filterPolicy{Mode: filterModePercentile, Percentile: 50}, classNeutral, 0, []string{"node1", "node2"}, ""},
+		"percentile tolerant":   {filterPolicy{Mode: filterModePercentile, Percentile: 50}, classTolerant, 100, []string{"node3", "node4"}, "below the percentile limit of 70"},
+		"band tolerant":         {filterPolicy{Mode: filterModeBand, Band: 25}, classTolerant, 100, []string{"node3", "node4"}, "below the band limit of 65"},
+		"band tolerant max":     {filterPolicy{Mode: filterModeBand, Band: 35}, classTolerant, 80, []string{"node2", "node3"}, "below the band limit of 35"},
+		"ceiling tolerant":      {filterPolicy{Mode: filterModeCeiling, MaxJoules: 50}, classTolerant, 100, []string{"node1", "node2"}, ""},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.filter
+		c.HeatClasses.Classes = warmClasses(0)
+		class := c.HeatClasses.Classes[tc.class]
+		class.MaxJoules = tc.classMax
+		c.HeatClasses.Classes[tc.class] = class
+		pod := newClassPod(tc.class)
+
+		passed, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		names := []string{}
+		for _, node := range passed {
+			names = append(names, node.Name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, names)
+		}
+		if tc.reason != "" && !strings.Contains(failed["node1"], tc.reason) {
+			t.Errorf("Test case %v: expected node1 to be rejected with %q but got %q", desc, tc.reason, failed["node1"])
+		}
+	}
+}
+
+// TestClassPrioritize tests that tolerant pods score warm nodes highest.
+func TestClassPrioritize(t *testing.T) {
+	list := newNodeList(
+		newNode("node1", "10"),
+		newNode("node2", "50"),
+		newNode("node3", "90"),
+		newNode("node4", ""),
+	)
+
+	testCases := map[string]struct {
+		class    string
+		expected []int
+	}{
+		"neutral":  {classNeutral, []int{10, 5, 0, 0}},
+		"tolerant": {classTolerant, []int{0, 5, 10, 0}},
+	}
+
+	for desc, tc := range testCases {
+		pod := newClassPod(tc.class)
+		c := defaultConfig()
+		c.HeatClasses.Classes = warmClasses(100)
+		c = withClass(c, &pod)
+		priorities, err := prioritizeNodes(c, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		for i, hp := range priorities {
+			if hp.Score != tc.expected[i] {
+				t.Errorf("Test case %v: expected %v to score %v but got %v", desc, hp.Host, tc.expected[i], hp.Score)
+			}
+		}
+	}
+}
+
+// TestClassBurst tests that back-to-back tolerant pods spread over the warm
+// nodes, as the reservation of every placement makes its node less
+// attractive to the next tolerant pod.
+func TestClassBurst(t *testing.T) {
+	defer func(l *reservations) { ledger = l }(ledger)
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.HeatClasses.Classes = warmClasses(500)
+	c.Reservations.Penalty = 50
+	setConfig(c)
+	now := time.Unix(0, 0)
+	ledger = newReservations(true, time.Minute)
+	ledger.now = fakeClock(&now)
+
+	list := newNodeList(newNode("a", "100"), newNode("b", "120"), newNode("c", "140"))
+	placed := make(map[string]int)
+	for i := 0; i < 5; i++ {
+		b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{Pod: newClassPod(classTolerant), Nodes: list})
+		if err != nil {
+			t.Fatalf("Error when trying to convert args to bytes: %v", err)
+		}
+		req, err := http.NewRequest("POST", "/filter", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		result := &filterResult{}
+		if err := json.NewDecoder(rec.Body).Decode(result); err != nil || len(result.Nodes.Items) != 1 {
+			t.Fatalf("Pod %v: expected one node but got %v (%v)", i, result.Nodes.Items, err)
+		}
+		placed[result.Nodes.Items[0].Name]++
+	}
+
+	if placed["c"] == 0 || placed["c"] > 2 || len(placed) != 3 {
+		t.Errorf("Expected the warmest node first and the pods spread over all nodes but got %v", placed)
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// defaultAddress is the address on which the extender listens for HTTP traffic.
+	defaultAddress = ":8100"
+	// defaultLabelKey is the key of the node label holding the joules of a node.
+	defaultLabelKey = "joules"
+)
+
+// config holds all settings of the extender. It is read from an optional JSON
+// config file, flags override the values from the file.
+type config struct {
+	Address      string            `json:"address"`
+	LabelKey     string            `json:"labelKey"`
+	LogLevel     string            `json:"logLevel"`
+	TLS          tlsFiles          `json:"tls"`
+	Filter       filterPolicy      `json:"filter"`
+	Strategy     strategyConfig    `json:"strategy"`
+	Reservations reservationConfig `json:"reservations"`
+	PodHeat      podHeatPolicy     `json:"podHeat"`
+	Audit        auditConfig       `json:"audit"`
+	Server       serverConfig      `json:"server"`
+	Source       heatSourceConfig  `json:"source"`
+	Missing      missingPolicy     `json:"missing"`
+	Staleness    stalenessPolicy   `json:"staleness"`
+	Exemptions   exemptionPolicy   `json:"exemptions"`
+	Headroom     headroomPolicy    `json:"headroom"`
+	Topology     topologyPolicy    `json:"topology"`
+	Critical     criticalPolicy    `json:"critical"`
+	NodeCache    nodeCacheConfig   `json:"nodeCache"`
+	HeatClasses  classPolicy       `json:"heatClasses"`
+	QOS          qosPolicy         `json:"qos"`
+	Budget       budgetPolicy      `json:"budget"`
+
+	path     string     // path of the config file, empty if flags only
+	strategy Strategy   // built from Strategy by loadConfig
+	source   HeatSource // built from Source by loadConfig
+	dryRun   bool       // set by explain, filtering then leaves shared state unchanged
+
+	// utilisation returns the utilisation of a node after placing the pod
+	// of a request, it is set per request by withHeadroom.
+	utilisation func(node *k8sApi.Node) (float64, bool)
+	// class is the heat class of the pod of a request, it is set per
+	// request by withClass.
+	class *podClass
+}
+
+// tlsFiles holds the files used to serve HTTPS, HTTP is served if the cert
+// and key file are empty. The files are reloaded when they change on disk.
+type tlsFiles struct {
+	CertFile     string `json:"certFile"`
+	KeyFile      string `json:"keyFile"`
+	ClientCAFile string `json:"clientCAFile"` // CA that signs the certificate of the scheduler, empty allows any client
+}
+
+// strategyConfig selects the strategy used in coolest mode.
+type strategyConfig struct {
+	Name string `json:"name"`
+	K    int    `json:"k"`    // number of coolest nodes round robin cycles through
+	Seed int64  `json:"seed"` // seed of the random strategies, 0 seeds from the current time
+}
+
+// reservationConfig configures the reservation ledger.
+type reservationConfig struct {
+	Penalty float64  `json:"penalty"` // joules added per placement, 0 disables reservations
+	Decay   duration `json:"decay"`   // time in which the penalty of a placement decays to zero
+}
+
+// auditConfig configures the decision audit log.
+type auditConfig struct {
+	Size int    `json:"size"` // number of decisions kept in memory
+	File string `json:"file"` // JSONL file every decision is appended to, empty disables the file
+}
+
+// duration is a time.Duration written as a string like "30s" in the config file.
+type duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration from a JSON string.
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\", got %s", b)
+	}
+	return d.Set(s)
+}
+
+// MarshalJSON writes a duration as a JSON string.
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Set parses a duration from a flag.
+func (d *duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// defaultConfig returns the config used when no file or flags are given.
+func defaultConfig() *config {
+	return &config{
+		Address:  defaultAddress,
+		LabelKey: defaultLabelKey,
+		LogLevel: "info",
+		Filter: filterPolicy{
+			Mode:       filterModeCoolest,
+			Percentile: 50,
+		},
+		Strategy: strategyConfig{
+			Name: strategyCoolest,
+			K:    3,
+		},
+		Reservations: reservationConfig{
+			Decay: duration{30 * time.Second},
+		},
+		PodHeat: podHeatPolicy{
+			Horizon: duration{time.Hour},
+		},
+		Audit: auditConfig{
+			Size: 1000,
+		},
+		Server: serverConfig{
+			ReadTimeout:     duration{5 * time.Second},
+			WriteTimeout:    duration{10 * time.Second},
+			IdleTimeout:     duration{2 * time.Minute},
+			ShutdownTimeout: duration{15 * time.Second},
+			MaxBodyBytes:    32 << 20,
+			MaxInFlight:     64,
+		},
+		Source: heatSourceConfig{
+			Kind:          heatSourceLabel,
+			AnnotationKey: defaultHeatAnnotationKey,
+			Interval:      duration{15 * time.Second},
+			Timeout:       duration{5 * time.Second},
+		},
+		Missing: missingPolicy{
+			Policy: missingOpen,
+		},
+		Staleness: stalenessPolicy{
+			UpdatedAtKey: defaultUpdatedAtKey,
+			Action:       staleUnknown,
+		},
+		HeatClasses: classPolicy{
+			Key:     defaultClassKey,
+			Default: classNeutral,
+			Classes: defaultClasses(),
+		},
+		QOS: qosPolicy{
+			BestEffortClass: classTolerant,
+		},
+		Budget: budgetPolicy{
+			PriorityKey:  defaultPriorityKey,
+			PriorityTier: defaultPriorityTier,
+		},
+		Topology: topologyPolicy{
+			Aggregate: aggregateMean,
+		},
+		strategy: coolestStrategy{},
+		source:   newCachedSource(labelSource{key: defaultLabelKey, updatedAtKey: defaultUpdatedAtKey}),
+	}
+}
+
+// newFlagSet returns a flag set that writes every flag into c.
+func newFlagSet(c *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("heat-scheduler-extender", flag.ContinueOnError)
+	fs.StringVar(&c.path, "config", c.path, "path of a JSON config file, flags override its values")
+	fs.StringVar(&c.Address, "address", c.Address, "address to listen on")
+	fs.StringVar(&c.LabelKey, "label-key", c.LabelKey, "key of the node label read by the label heat source")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "lowest level that is logged: debug, info or error")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert-file", c.TLS.CertFile, "certificate file used to serve HTTPS")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key-file", c.TLS.KeyFile, "private key file used to serve HTTPS")
+	fs.StringVar(&c.TLS.ClientCAFile, "tls-client-ca-file", c.TLS.ClientCAFile, "CA file verifying client certificates, the scheduler verbs require a verified client when set")
+	fs.StringVar(&c.Filter.Mode, "filter-mode", c.Filter.Mode, "which nodes pass the filter: coolest, ceiling, percentile or band")
+	fs.Float64Var(&c.Filter.MaxJoules, "max-joules", c.Filter.MaxJoules, "absolute joules ceiling used in ceiling mode")
+	fs.Float64Var(&c.Filter.Percentile, "percentile", c.Filter.Percentile, "joules percentile (0-100] of all nodes used in percentile mode")
+	fs.Float64Var(&c.Filter.Band, "band", c.Filter.Band, "joules above the coolest node allowed in band mode")
+	fs.StringVar(&c.Strategy.Name, "strategy", c.Strategy.Name, "how the node is picked in coolest mode: coolest, weighted-random, power-of-two or round-robin")
+	fs.IntVar(&c.Strategy.K, "strategy-k", c.Strategy.K, "number of coolest nodes round-robin cycles through")
+	fs.Int64Var(&c.Strategy.Seed, "strategy-seed", c.Strategy.Seed, "seed of the random strategies, 0 seeds from the current time")
+	fs.Float64Var(&c.Reservations.Penalty, "reservation-penalty", c.Reservations.Penalty, "joules added to a node for every pod placed on it until its label is updated, 0 disables reservations")
+	fs.Var(&c.Reservations.Decay, "reservation-decay", "time in which the penalty of a placement decays to zero")
+	fs.Float64Var(&c.PodHeat.JoulesPerCPUHour, "joules-per-cpu-hour", c.PodHeat.JoulesPerCPUHour, "joules per requested CPU per hour expected from pods without the "+podHeatAnnotation+" annotation")
+	fs.Var(&c.PodHeat.Horizon, "projection-horizon", "time over which the heat of a pod is projected")
+	fs.Float64Var(&c.PodHeat.MaxProjected, "max-projected-joules", c.PodHeat.MaxProjected, "reject nodes whose joules plus the projected heat of the pod exceed this value, 0 disables the check")
+	fs.IntVar(&c.Audit.Size, "audit-size", c.Audit.Size, "number of decisions kept in memory and served at /decisions")
+	fs.StringVar(&c.Audit.File, "audit-file", c.Audit.File, "JSONL file every decision is appended to, empty disables the file")
+	fs.Var(&c.Server.ReadTimeout, "read-timeout", "time allowed to read a request including its body")
+	fs.Var(&c.Server.WriteTimeout, "write-timeout", "time allowed to write a response")
+	fs.Var(&c.Server.IdleTimeout, "idle-timeout", "time a keep-alive connection may stay idle")
+	fs.Var(&c.Server.ShutdownTimeout, "shutdown-timeout", "time requests in flight get to finish on SIGTERM")
+	fs.Int64Var(&c.Server.MaxBodyBytes, "max-body-bytes", c.Server.MaxBodyBytes, "largest request body accepted from the scheduler")
+	fs.IntVar(&c.Server.MaxInFlight, "max-in-flight", c.Server.MaxInFlight, "scheduler requests served at once, further requests are answered with 503, 0 disables the limit")
+	fs.StringVar(&c.Source.Kind, "heat-source", c.Source.Kind, "where the heat of nodes is read: label, annotation or http")
+	fs.StringVar(&c.Source.AnnotationKey, "heat-annotation-key", c.Source.AnnotationKey, "key of the node annotation read by the annotation heat source")
+	fs.StringVar(&c.Source.URL, "heat-url", c.Source.URL, "URL of the heat service polled by the http heat source")
+	fs.Var(&c.Source.Interval, "heat-poll-interval", "time between two polls of the heat service")
+	fs.Var(&c.Source.Timeout, "heat-poll-timeout", "time a poll of the heat service may take")
+	fs.StringVar(&c.Missing.Policy, "missing-heat-policy", c.Missing.Policy, "what happens to nodes without heat: open, closed or impute, the config file can set a policy per namespace")
+	fs.StringVar(&c.Staleness.UpdatedAtKey, "updated-at-key", c.Staleness.UpdatedAtKey, "key of the label or annotation holding the time the heat of a node was written")
+	fs.Var(&c.Staleness.MaxAge, "max-heat-age", "heat older than this is stale, 0 disables the check")
+	fs.StringVar(&c.Staleness.Action, "stale-action", c.Staleness.Action, "what happens to stale heat: unknown treats it as missing, downweight adds -stale-penalty")
+	fs.Float64Var(&c.Staleness.Penalty, "stale-penalty", c.Staleness.Penalty, "joules added to stale heat by the downweight action")
+	fs.BoolVar(&c.Exemptions.Annotation, "exempt-annotation", c.Exemptions.Annotation, "exempt pods annotated with "+podExemptAnnotation+"=bypass or relax from heat filtering, rules are set in the config file")
+	fs.Float64Var(&c.Headroom.Weight, "headroom-weight", c.Headroom.Weight, "share of resource utilisation in the ranking of nodes from 0 to 1, 0 disables the pod watch")
+	fs.StringVar(&c.Headroom.APIServer, "api-server", c.Headroom.APIServer, "address of the API server pods are watched on, empty uses the in-cluster config")
+	fs.StringVar(&c.Topology.Key, "topology-key", c.Topology.Key, "node label grouping nodes by rack or zone, coolest mode picks the node from the coolest group, empty disables grouping")
+	fs.StringVar(&c.Topology.Aggregate, "topology-aggregate", c.Topology.Aggregate, "how the heat of a topology group is computed: mean, max or sum")
+	fs.Float64Var(&c.Critical.MaxJoules, "critical-joules", c.Critical.MaxJoules, "nodes above this value never pass the filter, 0 disables the cutoff")
+	fs.Float64Var(&c.Critical.Hysteresis, "critical-hysteresis", c.Critical.Hysteresis, "joules a critical node must cool below -critical-joules to pass the filter again")
+	fs.BoolVar(&c.NodeCache.Enabled, "node-cache", c.NodeCache.Enabled, "watch the nodes so the scheduler may send node names only, as schedulers of kubernetes 1.6 or later do for extenders configured with nodeCacheCapable")
+	fs.StringVar(&c.NodeCache.APIServer, "node-cache-api-server", c.NodeCache.APIServer, "address of the API server nodes are watched on, empty uses the in-cluster config")
+	fs.StringVar(&c.HeatClasses.Key, "heat-class-key", c.HeatClasses.Key, "pod annotation or label naming the heat class of a pod, classes are set in the config file")
+	fs.StringVar(&c.HeatClasses.Default, "default-heat-class", c.HeatClasses.Default, "heat class of pods that name no class or an unknown one")
+	fs.BoolVar(&c.QOS.Enabled, "qos-aware", c.QOS.Enabled, "place pods according to their QoS class and reserve the heat they are expected to add")
+	fs.Float64Var(&c.QOS.StrictCPU, "strict-cpu", c.QOS.StrictCPU, "CPUs a guaranteed pod must request to be placed on the coolest node when QoS aware")
+	fs.StringVar(&c.QOS.BestEffortClass, "best-effort-class", c.QOS.BestEffortClass, "heat class of best effort pods that name no class when QoS aware, it must prefer warm nodes")
+	fs.Float64Var(&c.Budget.MaxWatts, "power-budget", c.Budget.MaxWatts, "soft budget of the estimated watts of the cluster, pods that would exceed it are rejected, 0 disables the budget, a budget watches the nodes on the node cache API server")
+	fs.Float64Var(&c.Budget.HardMaxWatts, "hard-power-budget", c.Budget.HardMaxWatts, "budget of pods in the priority tier, 0 lets them exceed the soft budget without limit")
+	fs.StringVar(&c.Budget.PriorityKey, "priority-key", c.Budget.PriorityKey, "pod annotation or label naming the priority tier of a pod")
+	fs.StringVar(&c.Budget.PriorityTier, "priority-tier", c.Budget.PriorityTier, "priority tier allowed to exceed the soft power budget, empty allows no tier")
+	return fs
+}
+
+// loadConfig returns the config described by the command line arguments and
+// the config file they point to.
+func loadConfig(args []string) (*config, error) {
+	// the first pass only finds the config file.
+	c := defaultConfig()
+	if err := newFlagSet(c).Parse(args); err != nil {
+		return nil, err
+	}
+
+	if c.path != "" {
+		path := c.path
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %v", err)
+		}
+		c = defaultConfig()
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("could not parse config file %v: %v", path, err)
+		}
+		c.path = path
+
+		// flags take precedence over the config file.
+		if err := newFlagSet(c).Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	seed := c.Strategy.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s, err := newStrategy(c.Strategy.Name, c.Strategy.K, seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid strategy: %v", err)
+	}
+	c.strategy = s
+	c.source = newHeatSource(c)
+	return c, nil
+}
+
+// validate returns an error describing the first invalid setting of c.
+func (c *config) validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address must not be empty")
+	}
+	if c.LabelKey == "" {
+		return fmt.Errorf("label key must not be empty")
+	}
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return fmt.Errorf("unknown log level %q", c.LogLevel)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert file and key file must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("tls client CA file requires a cert file and key file")
+	}
+	for _, f := range []string{c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("tls file: %v", err)
+		}
+	}
+	if err := c.Filter.validate(); err != nil {
+		return fmt.Errorf("invalid filter policy: %v", err)
+	}
+	if c.Reservations.Penalty < 0 {
+		return fmt.Errorf("reservation penalty must not be negative, got %v", c.Reservations.Penalty)
+	}
+	if c.Reservations.Decay.Duration <= 0 {
+		return fmt.Errorf("reservation decay must be positive, got %v", c.Reservations.Decay)
+	}
+	if err := c.PodHeat.validate(); err != nil {
+		return fmt.Errorf("invalid pod heat policy: %v", err)
+	}
+	if c.Audit.Size < 1 {
+		return fmt.Errorf("audit size must be at least 1, got %v", c.Audit.Size)
+	}
+	if err := c.Server.validate(); err != nil {
+		return fmt.Errorf("invalid server config: %v", err)
+	}
+	if err := c.Source.validate(); err != nil {
+		return fmt.Errorf("invalid heat source: %v", err)
+	}
+	if err := c.Missing.validate(); err != nil {
+		return fmt.Errorf("invalid missing heat policy: %v", err)
+	}
+	if err := c.Staleness.validate(); err != nil {
+		return fmt.Errorf("invalid staleness policy: %v", err)
+	}
+	if err := c.Exemptions.validate(); err != nil {
+		return fmt.Errorf("invalid exemption policy: %v", err)
+	}
+	if err := c.Headroom.validate(); err != nil {
+		return fmt.Errorf("invalid headroom policy: %v", err)
+	}
+	if err := c.Topology.validate(); err != nil {
+		return fmt.Errorf("invalid topology policy: %v", err)
+	}
+	if err := c.Critical.validate(); err != nil {
+		return fmt.Errorf("invalid critical policy: %v", err)
+	}
+	if err := c.HeatClasses.validate(c.Critical); err != nil {
+		return fmt.Errorf("invalid heat classes: %v", err)
+	}
+	if err := c.QOS.validate(c.HeatClasses); err != nil {
+		return fmt.Errorf("invalid qos policy: %v", err)
+	}
+	if err := c.Budget.validate(); err != nil {
+		return fmt.Errorf("invalid power budget: %v", err)
+	}
+	return nil
+}
+
+var (
+	cfgMu sync.RWMutex // guards cfg
+	cfg   = defaultConfig()
+)
+
+// currentConfig returns the active config. A request uses the config it got
+// at the start for its whole lifetime, so a reload never affects a request
+// in flight.
+func currentConfig() *config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// setConfig makes c the active config and starts its heat source. The config
+// stays active when the audit file can not be opened.
+func setConfig(c *config) error {
+	cfgMu.Lock()
+	c.source = switchSource(cfg.source, c.source)
+	cfg = c
+	cfgMu.Unlock()
+	setLogLevel(c.LogLevel)
+	ledger.configure(c.reservesHeat(), c.Reservations.Decay.Duration)
+	admitted.configure(c.Reservations.Decay.Duration)
+	return audit.configure(c.Audit.Size, c.Audit.File)
+}
+
+// reloadOnSignal reloads the config every time a signal arrives on ch. The
+// caller registers ch for SIGHUP before starting it so no signal is missed.
+// An invalid config is logged and the active config is kept.
+func reloadOnSignal(ch <-chan os.Signal, args []string) {
+	for range ch {
+		if err := reloadConfig(args); err != nil {
+			errorf("Reload on SIGHUP: %v", err)
+			continue
+		}
+		infof("Reloaded config")
+	}
+}
+
+// reloadConfig loads the config described by args and makes it active. The
+// settings only applied at startup keep the values of the active config, so
+// requests are never served with settings the listener and watches do not
+// use.
+func reloadConfig(args []string) error {
+	c, err := loadConfig(args)
+	if err != nil {
+		return fmt.Errorf("could not reload config, keeping the active config: %v", err)
+	}
+	old := currentConfig()
+	if needsRestart(old, c) {
+		errorf("Changes to the address, tls files, server timeouts, pod watch, node cache and enabling the power budget only take effect after a restart")
+		keepStartupSettings(old, c)
+	}
+	if err := setConfig(c); err != nil {
+		return fmt.Errorf("reloaded config with errors: %v", err)
+	}
+	return nil
+}
+
+// keepStartupSettings copies the settings of old that are only applied at
+// startup into c.
+func keepStartupSettings(old, c *config) {
+	c.Address = old.Address
+	c.TLS = old.TLS
+	c.Server.ReadTimeout = old.Server.ReadTimeout
+	c.Server.WriteTimeout = old.Server.WriteTimeout
+	c.Server.IdleTimeout = old.Server.IdleTimeout
+	c.Server.ShutdownTimeout = old.Server.ShutdownTimeout
+	if (c.Headroom.Weight > 0) != (old.Headroom.Weight > 0) {
+		c.Headroom.Weight = old.Headroom.Weight
+	}
+	c.Headroom.APIServer = old.Headroom.APIServer
+	c.NodeCache = old.NodeCache
+	if c.Budget.MaxWatts > 0 && !old.watchesNodes() {
+		c.Budget.MaxWatts = 0
+	}
+}
+
+// needsRestart returns whether c changes settings of old that are only
+// applied at startup.
+func needsRestart(old, c *config) bool {
+	return c.Address != old.Address || c.TLS != old.TLS ||
+		c.Server.ReadTimeout != old.Server.ReadTimeout ||
+		c.Server.WriteTimeout != old.Server.WriteTimeout ||
+		c.Server.IdleTimeout != old.Server.IdleTimeout ||
+		c.Server.ShutdownTimeout != old.Server.ShutdownTimeout ||
+		(c.Headroom.Weight > 0) != (old.Headroom.Weight > 0) ||
+		c.Headroom.APIServer != old.Headroom.APIServer ||
+		c.NodeCache != old.NodeCache ||
+		(c.Budget.MaxWatts > 0 && !old.watchesNodes())
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory
+// and returns its path and a function that removes the directory.
+func writeConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "extender-config")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Error writing config file: %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// TestLoadConfigDefaults tests that no arguments give the default config.
+func TestLoadConfigDefaults(t *testing.T) {
+	c, err := loadConfig(nil)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	if c.Address != defaultAddress || c.LabelKey != defaultLabelKey || c.Filter.Mode != filterModeCoolest {
+		t.Errorf("Expected the default config but got %+v", c)
+	}
+	if c.strategy == nil || c.strategy.Name() != strategyCoolest {
+		t.Errorf("Expected the coolest strategy but got %v", c.strategy)
+	}
+}
+
+// TestLoadConfigFileAndFlags tests that values are read from the config file
+// and that flags take precedence over it.
+func TestLoadConfigFileAndFlags(t *testing.T) {
+	path, cleanup := writeConfigFile(t, `{
+		"labelKey": "heat",
+		"logLevel": "debug",
+		"filter": {"mode": "band", "band": 5},
+		"strategy": {"name": "round-robin", "k": 2},
+		"reservations": {"penalty": 3, "decay": "10s"}
+	}`)
+	defer cleanup()
+
+	c, err := loadConfig([]string{"-config", path, "-address", ":9000", "-band", "7"})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	if c.Address != ":9000" {
+		t.Errorf("Expected address from flag but got %v", c.Address)
+	}
+	if c.LabelKey != "heat" || c.LogLevel != "debug" {
+		t.Errorf("Expected label key and log level from file but got %v and %v", c.LabelKey, c.LogLevel)
+	}
+	if c.Filter.Mode != filterModeBand || c.Filter.Band != 7 {
+		t.Errorf("Expected band mode with band 7 but got %+v", c.Filter)
+	}
+	if c.strategy.Name() != strategyRoundRobin {
+		t.Errorf("Expected round robin strategy but got %v", c.strategy.Name())
+	}
+	if c.Reservations.Penalty != 3 || c.Reservations.Decay.Duration != 10*time.Second {
+		t.Errorf("Expected reservations from file but got %+v", c.Reservations)
+	}
+	if c.PodHeat.Horizon.Duration != time.Hour {
+		t.Errorf("Expected the default horizon but got %v", c.PodHeat.Horizon)
+	}
+}
+
+// TestLoadConfigInvalid tests that invalid configs are rejected.
+func TestLoadConfigInvalid(t *testing.T) {
+	testCases := map[string]struct {
+		file string
+		args []string
+	}{
+		"unknown flag":               {args: []string{"-hottest"}},
+		"missing file":               {args: []string{"-config", "/does/not/exist.json"}},
+		"malformed file":             {file: `{"address": `},
+		"bad duration":               {file: `{"reservations": {"decay": 30}}`},
+		"empty label key":            {args: []string{"-label-key", ""}},
+		"unknown log level":          {args: []string{"-log-level", "verbose"}},
+		"unknown mode":               {args: []string{"-filter-mode", "hottest"}},
+		"unknown strategy":           {args: []string{"-strategy", "hottest"}},
+		"negative penalty":           {args: []string{"-reservation-penalty", "-1"}},
+		"zero horizon":               {args: []string{"-projection-horizon", "0s"}},
+		"cert without key":           {args: []string{"-tls-cert-file", "cert.pem"}},
+		"missing tls files":          {args: []string{"-tls-cert-file", "cert.pem", "-tls-key-file", "key.pem"}},
+		"client ca without cert":     {args: []string{"-tls-client-ca-file", "ca.pem"}},
+		"zero read timeout":          {args: []string{"-read-timeout", "0s"}},
+		"negative max in flight":     {args: []string{"-max-in-flight", "-1"}},
+		"unknown heat source":        {args: []string{"-heat-source", "thermometer"}},
+		"relative heat url":          {args: []string{"-heat-source", "http", "-heat-url", "heat"}},
+		"unknown stale action":       {args: []string{"-stale-action", "ignore"}},
+		"downweight no penalty":      {args: []string{"-max-heat-age", "1m", "-stale-action", "downweight"}},
+		"headroom weight above 1":    {args: []string{"-headroom-weight", "1.5"}},
+		"unknown topology aggregate": {args: []string{"-topology-aggregate", "median"}},
+		"hysteresis above critical":  {args: []string{"-critical-joules", "100", "-critical-hysteresis", "150"}},
+		"unknown default class":      {args: []string{"-default-heat-class", "lukewarm"}},
+		"class preferring hot":       {file: `{"heatClasses": {"classes": {"tolerant": {"prefer": "hot"}}}}`},
+		"warm class without limit":   {file: `{"heatClasses": {"classes": {"tolerant": {"prefer": "warm"}}}}`},
+		"unknown best effort class":  {args: []string{"-best-effort-class", "lukewarm"}},
+		"cool best effort class":     {args: []string{"-qos-aware"}},
+		"hard budget below soft":     {args: []string{"-power-budget", "1000", "-hard-power-budget", "500"}},
+		"round robin zero k":         {file: `{"strategy": {"name": "round-robin", "k": 0}}`},
+	}
+
+	for desc, tc := range testCases {
+		args := tc.args
+		if tc.file != "" {
+			path, cleanup := writeConfigFile(t, tc.file)
+			defer cleanup()
+			args = append([]string{"-config", path}, args...)
+		}
+		if _, err := loadConfig(args); err == nil {
+			t.Errorf("Test case %v: expected error", desc)
+		}
+	}
+}
+
+// TestSetConfig tests that setting a config applies the log level and the
+// reservation settings.
+func TestSetConfig(t *testing.T) {
+	defer setConfig(currentConfig())
+
+	c := defaultConfig()
+	c.LogLevel = "error"
+	c.Reservations = reservationConfig{Penalty: 4, Decay: duration{time.Minute}}
+	setConfig(c)
+
+	if currentConfig() != c {
+		t.Errorf("Expected the config to be active")
+	}
+	if logLevel != levelError {
+		t.Errorf("Expected log level %v but got %v", levelError, logLevel)
+	}
+	if !ledger.enabled || ledger.decay != time.Minute {
+		t.Errorf("Expected reservations to be configured but got enabled %v and decay %v", ledger.enabled, ledger.decay)
+	}
+}
+
+// TestReloadConfig tests that a reload applies new settings but keeps the
+// settings only applied at startup, so a new client CA file never rejects
+// the scheduler while the listener still uses the old one.
+func TestReloadConfig(t *testing.T) {
+	defer setConfig(currentConfig())
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cert := writeFile(t, dir, "cert.pem", []byte("cert"))
+	key := writeFile(t, dir, "key.pem", []byte("key"))
+	ca := writeFile(t, dir, "ca.pem", []byte("ca"))
+
+	old := defaultConfig()
+	old.TLS = tlsFiles{CertFile: cert, KeyFile: key}
+	setConfig(old)
+
+	args := []string{
+		"-address", ":9100",
+		"-tls-cert-file", cert, "-tls-key-file", key, "-tls-client-ca-file", ca,
+		"-read-timeout", "1s",
+		"-headroom-weight", "0.5",
+		"-node-cache",
+		"-power-budget", "1000",
+		"-log-level", "error",
+	}
+	if err := reloadConfig(args); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c := currentConfig()
+	if c.Address != old.Address || c.TLS != old.TLS || c.Server.ReadTimeout != old.Server.ReadTimeout {
+		t.Errorf("Expected the address, tls files and timeouts to be kept but got %v, %+v and %v", c.Address, c.TLS, c.Server.ReadTimeout)
+	}
+	if c.Headroom.Weight != 0 {
+		t.Errorf("Expected the headroom to stay disabled without a pod watch but got weight %v", c.Headroom.Weight)
+	}
+	if c.NodeCache.Enabled {
+		t.Errorf("Expected the node cache to stay disabled without a node watch")
+	}
+	if c.Budget.MaxWatts != 0 {
+		t.Errorf("Expected the power budget to stay disabled without a node watch but got %v", c.Budget.MaxWatts)
+	}
+	if c.LogLevel != "error" {
+		t.Errorf("Expected the log level to be reloaded but got %v", c.LogLevel)
+	}
+
+	if err := reloadConfig([]string{"-log-level", "verbose"}); err == nil {
+		t.Errorf("Expected an invalid config to be rejected")
+	}
+	if currentConfig() != c {
+		t.Errorf("Expected an invalid config to keep the active config")
+	}
+}
+
+// TestConfigExample tests that the example config file is valid.
+func TestConfigExample(t *testing.T) {
+	if _, err := loadConfig([]string{"-config", "config.example.json"}); err != nil {
+		t.Errorf("Expected the example config to be valid: %v", err)
+	}
+}
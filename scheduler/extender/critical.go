@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// criticalPolicy sets the heat above which a node is never eligible, for
+// every pod and whatever the filter mode or strategy.
+type criticalPolicy struct {
+	MaxJoules  float64 `json:"maxJoules"`  // nodes above this value are filtered, 0 disables the cutoff
+	Hysteresis float64 `json:"hysteresis"` // joules a critical node must cool below MaxJoules to be eligible again
+}
+
+// validate returns an error describing the first invalid setting of p.
+func (p criticalPolicy) validate() error {
+	if p.MaxJoules < 0 {
+		return fmt.Errorf("max joules must not be negative, got %v", p.MaxJoules)
+	}
+	if p.Hysteresis < 0 || p.Hysteresis > p.MaxJoules {
+		return fmt.Errorf("hysteresis must be between 0 and the max joules of %v, got %v", p.MaxJoules, p.Hysteresis)
+	}
+	return nil
+}
+
+// criticalTracker remembers which nodes were last seen above the critical
+// level, so they stay critical until they cool below the hysteresis band.
+type criticalTracker struct {
+	mu  sync.Mutex      // guards hot
+	hot map[string]bool // names of the nodes that are critical
+}
+
+// critical tracks the critical nodes for all handlers.
+var critical = newCriticalTracker()
+
+// newCriticalTracker returns a tracker without critical nodes.
+func newCriticalTracker() *criticalTracker {
+	return &criticalTracker{hot: make(map[string]bool)}
+}
+
+// limit returns the joules a node may have before it is critical. It is
+// lowered by the hysteresis for nodes that are critical already.
+func (n *criticalTracker) limit(p criticalPolicy, node string) float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.hot[node] {
+		return p.MaxJoules - p.Hysteresis
+	}
+	return p.MaxJoules
+}
+
+// set records whether a node is critical.
+func (n *criticalTracker) set(node string, hot bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if hot {
+		n.hot[node] = true
+		return
+	}
+	delete(n.hot, node)
+}
+
+// filterCritical drops the nodes above the critical level and returns the
+// remaining nodes and a map from the name of every dropped node to the reason
+// it was dropped. Nodes without heat are left to the missing heat policy. It
+// fails with the joules of every node when all nodes are critical.
+func filterCritical(c *config, nodes []candidate) ([]candidate, map[string]string, error) {
+	failed := make(map[string]string)
+	if c.Critical.MaxJoules == 0 {
+		return nodes, failed, nil
+	}
+
+	eligible := make([]candidate, 0, len(nodes))
+	values := []string{}
+	for _, node := range nodes {
+		joules := node.heat()
+		if joules == math.MaxFloat64 {
+			eligible = append(eligible, node)
+			continue
+		}
+		limit := critical.limit(c.Critical, node.Name)
+		hot := joules > limit
+		if !c.dryRun {
+			critical.set(node.Name, hot)
+		}
+		if !hot {
+			eligible = append(eligible, node)
+			continue
+		}
+		if limit < c.Critical.MaxJoules {
+			failed[node.Name] = fmt.Sprintf("node joules %v are critical until they cool to %v", joules, limit)
+		} else {
+			failed[node.Name] = fmt.Sprintf("node joules %v exceed the critical level of %v", joules, limit)
+		}
+		values = append(values, fmt.Sprintf("%v=%v", node.Name, joules))
+	}
+
+	if !c.dryRun {
+		criticalNodes.Set(float64(len(values)))
+	}
+	if len(eligible) == 0 {
+		sort.Strings(values)
+		return nil, failed, fmt.Errorf("all %v nodes are above the critical level of %v joules, the cluster is saturated: %v",
+			len(nodes), c.Critical.MaxJoules, strings.Join(values, ", "))
+	}
+	return eligible, failed, nil
+}
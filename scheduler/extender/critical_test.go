@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestFilterCritical tests that nodes above the critical level are filtered
+// whatever the filter mode and that a node stays critical until it cools
+// below the hysteresis band.
+func TestFilterCritical(t *testing.T) {
+	defer func(n *criticalTracker) { critical = n }(critical)
+	critical = newCriticalTracker()
+
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 1000}
+	c.Critical = criticalPolicy{MaxJoules: 100, Hysteresis: 10}
+	pod := newPod("web", nil)
+
+	testCases := []struct {
+		desc     string
+		joules   string
+		expected bool
+	}{
+		{"below", "95", true},
+		{"above", "101", false},
+		{"inside band", "95", false},
+		{"at band edge", "90", true},
+		{"inside band after cooling", "95", true},
+	}
+
+	for _, tc := range testCases {
+		list := newNodeList(newNode("node1", tc.joules), newNode("node2", "50"))
+		passed, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", tc.desc, err)
+			continue
+		}
+		if got := len(passed) == 2; got != tc.expected {
+			t.Errorf("Test case %v: expected node1 to pass %v but got %v (%v)", tc.desc, tc.expected, got, failed["node1"])
+		}
+	}
+
+	// explain must not change which nodes are critical.
+	list := newNodeList(newNode("node1", "101"), newNode("node2", "50"))
+	explainFilter(c, &pod, &list)
+	if critical.hot["node1"] {
+		t.Errorf("Expected explain not to record node1 as critical")
+	}
+}
+
+// TestFilterCriticalSaturated tests that the filter fails with the joules of
+// every node when all nodes are critical, even for exempt pods.
+func TestFilterCriticalSaturated(t *testing.T) {
+	defer func(n *criticalTracker) { critical = n }(critical)
+	critical = newCriticalTracker()
+
+	c := defaultConfig()
+	c.Critical = criticalPolicy{MaxJoules: 100}
+	c.Exemptions = exemptionPolicy{Annotation: true}
+	pod := newPod("web", map[string]string{podExemptAnnotation: exemptBypass})
+	list := newNodeList(newNode("node2", "120"), newNode("node1", "101"))
+
+	passed, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+	if err == nil {
+		t.Fatalf("Expected an error but got %v", passed)
+	}
+	if !strings.Contains(err.Error(), "node1=101, node2=120") {
+		t.Errorf("Expected the error to list every node but got %q", err)
+	}
+	if len(failed) != 2 {
+		t.Errorf("Expected both nodes to be rejected but got %v", failed)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sLabels "k8s.io/kubernetes/pkg/labels"
+)
+
+const (
+	// exemptBypass ignores heat for the pod, every node below the critical
+	// level passes the filter and every node receives the same score.
+	exemptBypass = "bypass"
+	// exemptRelax lets every node below the critical level pass the filter
+	// but still scores cooler nodes higher, so heat only breaks ties in the
+	// kubernetes scheduler.
+	exemptRelax = "relax"
+
+	// podExemptAnnotation exempts a pod when the exemption policy honours
+	// annotations, its value is the action.
+	podExemptAnnotation = "heat-scheduling/exempt"
+)
+
+// exemptionPolicy decides which pods are exempt from heat filtering. The
+// policy is part of the config file, which can be mounted from a ConfigMap
+// and reloaded with SIGHUP.
+type exemptionPolicy struct {
+	Rules      []exemptionRule `json:"rules"`
+	Annotation bool            `json:"annotation"` // honour the podExemptAnnotation of pods
+}
+
+// exemptionRule exempts the pods that match all of its criteria, empty
+// criteria match every pod.
+type exemptionRule struct {
+	Name       string   `json:"name"`       // recorded in the decisions of exempt pods
+	Namespaces []string `json:"namespaces"` // namespaces the pod may be in
+	Selector   string   `json:"selector"`   // label selector the pod must match, e.g. "k8s-app=kube-dns"
+	Action     string   `json:"action"`     // bypass or relax
+}
+
+// exemption records why a pod is exempt.
+type exemption struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+}
+
+// validate returns an error describing the first invalid rule.
+func (p exemptionPolicy) validate() error {
+	for i, r := range p.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("rule %v has no name", i)
+		}
+		if r.Action != exemptBypass && r.Action != exemptRelax {
+			return fmt.Errorf("rule %v has unknown action %q", r.Name, r.Action)
+		}
+		if len(r.Namespaces) == 0 && r.Selector == "" {
+			return fmt.Errorf("rule %v has no namespaces and no selector, it would exempt every pod", r.Name)
+		}
+		if _, err := k8sLabels.Parse(r.Selector); err != nil {
+			return fmt.Errorf("rule %v has invalid selector: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// match returns why pod is exempt, or nil if it is not. Rules are tried in
+// order before the annotation of the pod.
+func (p exemptionPolicy) match(pod *k8sApi.Pod) *exemption {
+	for _, r := range p.Rules {
+		if r.matches(pod) {
+			return &exemption{Rule: r.Name, Action: r.Action}
+		}
+	}
+	if !p.Annotation {
+		return nil
+	}
+	switch action := pod.Annotations[podExemptAnnotation]; action {
+	case "":
+		return nil
+	case exemptBypass, exemptRelax:
+		return &exemption{Rule: "annotation " + podExemptAnnotation, Action: action}
+	default:
+		errorf("Ignoring %v annotation of pod %v with unknown action %q", podExemptAnnotation, pod.Name, action)
+		return nil
+	}
+}
+
+// matches returns whether pod matches all criteria of the rule.
+func (r exemptionRule) matches(pod *k8sApi.Pod) bool {
+	if len(r.Namespaces) > 0 {
+		found := false
+		for _, ns := range r.Namespaces {
+			if pod.Namespace == ns {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Selector == "" {
+		return true
+	}
+	selector, err := k8sLabels.Parse(r.Selector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(k8sLabels.Set(pod.Labels))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// newExemptPolicy returns the exemption policy used by the tests.
+func newExemptPolicy() exemptionPolicy {
+	return exemptionPolicy{
+		Rules: []exemptionRule{
+			{Name: "dns", Namespaces: []string{"kube-system"}, Selector: "k8s-app=kube-dns", Action: exemptBypass},
+			{Name: "monitoring", Namespaces: []string{"monitoring", "logging"}, Action: exemptRelax},
+			{Name: "critical", Selector: "tier in (critical)", Action: exemptBypass},
+		},
+		Annotation: true,
+	}
+}
+
+// TestExemptionMatch tests which pods are exempt and why.
+func TestExemptionMatch(t *testing.T) {
+	pod := func(ns string, labels, annotations map[string]string) *k8sApi.Pod {
+		p := newPod("pod", annotations)
+		p.Namespace, p.Labels = ns, labels
+		return &p
+	}
+
+	testCases := map[string]struct {
+		pod      *k8sApi.Pod
+		rule     string
+		action   string
+		disabled bool
+	}{
+		"dns":                    {pod("kube-system", map[string]string{"k8s-app": "kube-dns"}, nil), "dns", exemptBypass, false},
+		"other system pod":       {pod("kube-system", map[string]string{"k8s-app": "dashboard"}, nil), "", "", false},
+		"dns label elsewhere":    {pod("default", map[string]string{"k8s-app": "kube-dns"}, nil), "", "", false},
+		"second namespace":       {pod("logging", nil, nil), "monitoring", exemptRelax, false},
+		"selector only":          {pod("default", map[string]string{"tier": "critical"}, nil), "critical", exemptBypass, false},
+		"annotation":             {pod("default", nil, map[string]string{podExemptAnnotation: exemptRelax}), "annotation " + podExemptAnnotation, exemptRelax, false},
+		"unknown annotation":     {pod("default", nil, map[string]string{podExemptAnnotation: "always"}), "", "", false},
+		"annotation disabled":    {pod("default", nil, map[string]string{podExemptAnnotation: exemptRelax}), "", "", true},
+		"rule before annotation": {pod("logging", nil, map[string]string{podExemptAnnotation: exemptBypass}), "monitoring", exemptRelax, false},
+		"not exempt":             {pod("default", nil, nil), "", "", false},
+	}
+
+	for desc, tc := range testCases {
+		p := newExemptPolicy()
+		p.Annotation = !tc.disabled
+		x := p.match(tc.pod)
+		if tc.rule == "" {
+			if x != nil {
+				t.Errorf("Test case %v: expected no exemption but got %+v", desc, x)
+			}
+			continue
+		}
+		if x == nil || x.Rule != tc.rule || x.Action != tc.action {
+			t.Errorf("Test case %v: expected rule %v (%v) but got %+v", desc, tc.rule, tc.action, x)
+		}
+	}
+}
+
+// TestExemptionHandlers tests that exempt pods pass the filter on every node,
+// bypass equalizes the scores and the exemption is recorded.
+func TestExemptionHandlers(t *testing.T) {
+	defer func(a *auditLog) { audit = a }(audit)
+	audit = newAuditLog(10)
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Exemptions = newExemptPolicy()
+	setConfig(c)
+
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	pod := newPod("dns", nil)
+	pod.Namespace, pod.Labels = "kube-system", map[string]string{"k8s-app": "kube-dns"}
+	b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{
+		Pod:   pod,
+		Nodes: newNodeList(newNode("node1", "50"), newNode("node2", "90"), newNode("node3", "")),
+	})
+	if err != nil {
+		t.Fatalf("Error when trying to convert args to bytes: %v", err)
+	}
+
+	res, err := http.Post(srv.URL+"/filter", "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := &filterResult{}
+	json.NewDecoder(res.Body).Decode(result)
+	res.Body.Close()
+	if len(result.Nodes.Items) != 3 {
+		t.Errorf("Expected all 3 nodes to pass for an exempt pod but got %v", len(result.Nodes.Items))
+	}
+
+	res, err = http.Post(srv.URL+"/prioritize", "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	priorities := k8sSchedulerApi.HostPriorityList{}
+	json.NewDecoder(res.Body).Decode(&priorities)
+	res.Body.Close()
+	if len(priorities) != 3 {
+		t.Fatalf("Expected 3 scores but got %v", len(priorities))
+	}
+	for _, hp := range priorities {
+		if hp.Score != priorities[0].Score {
+			t.Errorf("Expected equal scores for a bypassed pod but got %v", priorities)
+			break
+		}
+	}
+
+	for _, d := range audit.list() {
+		if d.Exempt == nil || d.Exempt.Rule != "dns" || d.Exempt.Action != exemptBypass {
+			t.Errorf("Expected the %v decision to record the dns exemption but got %+v", d.Verb, d.Exempt)
+		}
+	}
+}
+
+// TestExemptionPolicyValidate tests that invalid rules are rejected.
+func TestExemptionPolicyValidate(t *testing.T) {
+	testCases := map[string]struct {
+		rule  exemptionRule
+		valid bool
+	}{
+		"namespace":        {exemptionRule{Name: "a", Namespaces: []string{"kube-system"}, Action: exemptBypass}, true},
+		"selector":         {exemptionRule{Name: "a", Selector: "app=dns", Action: exemptRelax}, true},
+		"no name":          {exemptionRule{Namespaces: []string{"kube-system"}, Action: exemptBypass}, false},
+		"unknown action":   {exemptionRule{Name: "a", Namespaces: []string{"kube-system"}, Action: "skip"}, false},
+		"matches all pods": {exemptionRule{Name: "a", Action: exemptBypass}, false},
+		"invalid selector": {exemptionRule{Name: "a", Selector: "app in dns", Action: exemptBypass}, false},
+	}
+
+	for desc, tc := range testCases {
+		p := exemptionPolicy{Rules: []exemptionRule{tc.rule}}
+		if err := p.validate(); (err == nil) != tc.valid {
+			t.Errorf("Test case %v: expected valid=%v but got %v", desc, tc.valid, err)
+		}
+	}
+}
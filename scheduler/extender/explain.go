@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	verdictPass   = "pass"
+	verdictReject = "reject"
+)
+
+// explanation describes how a filter call for a pod would be decided.
+type explanation struct {
+	Namespace  string            `json:"namespace"`
+	Pod        string            `json:"pod"`
+	FilterMode string            `json:"filterMode"`
+	Strategy   string            `json:"strategy"`
+	Class      string            `json:"class"`         // heat class of the pod
+	QOS        string            `json:"qos,omitempty"` // QoS class of the pod when placement is QoS aware
+	Thresholds thresholds        `json:"thresholds"`
+	Nodes      []nodeExplanation `json:"nodes"`
+	Groups     []topologyGroup   `json:"groups,omitempty"` // topology groups of the nodes reaching the filter policy in the order the heat class prefers, the strategy picks from the first
+	Exempt     *exemption        `json:"exempt,omitempty"`
+	Budget     *budgetEstimate   `json:"budget,omitempty"` // estimated cluster power when a power budget is set
+	Error      string            `json:"error,omitempty"`
+}
+
+// thresholds holds the thresholds applied to a filter call.
+type thresholds struct {
+	Limit         *float64 `json:"limit,omitempty"`        // joules limit of the filter mode, nil in coolest mode
+	Floor         *float64 `json:"floor,omitempty"`        // joules floor of the filter mode for heat classes preferring warm nodes
+	ClassMax      float64  `json:"classMax,omitempty"`     // joules limit of the heat class, 0 if disabled
+	ProjectedHeat float64  `json:"projectedHeat"`          // joules the pod is expected to add
+	MaxProjected  float64  `json:"maxProjected,omitempty"` // max joules after adding the pod, 0 if disabled
+	Critical      float64  `json:"critical,omitempty"`     // joules above which nodes never pass, 0 if disabled
+}
+
+// nodeExplanation describes how a single node would be treated.
+type nodeExplanation struct {
+	Rank      int      `json:"rank"`
+	Node      string   `json:"node"`
+	Group     string   `json:"group,omitempty"`  // topology group of the node
+	Joules    *float64 `json:"joules"`           // parsed joules label, nil if missing or invalid
+	Penalty   float64  `json:"penalty"`          // provisional joules of recent placements
+	Effective *float64 `json:"effective"`        // joules plus penalty, nil if unknown
+	Score     *float64 `json:"score,omitempty"`  // value the strategy ranks the node by, lower is better, nil if the node did not reach the filter policy
+	Chance    float64  `json:"chance"`           // chance the strategy picks the node in coolest mode
+	Verdict   string   `json:"verdict"`          // pass or reject
+	Reason    string   `json:"reason,omitempty"` // why the node is rejected
+}
+
+// previewStrategy picks the node the wrapped strategy is most likely to pick
+// without changing the wrapped strategy.
+type previewStrategy struct {
+	Strategy
+}
+
+func (s previewStrategy) Select(nodes []k8sApi.Node, joules []float64) int {
+	chances := s.Chances(joules)
+	best := 0
+	for i := range chances {
+		if chances[i] > chances[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// explain handles an explain request. explain accepts the same payload as the
+// filter verb and returns every node ranked as the strategy ranks it with the
+// verdict the filter would give, without reserving heat, recording a decision
+// or updating metrics.
+func explain(w http.ResponseWriter, r *http.Request) {
+	c := currentConfig()
+
+	received, err := decodeArgs(c, r)
+	if err != nil {
+		writeJSON(w, decodeStatus(err), &errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, explainFilter(c, &received.Pod, &received.Nodes))
+}
+
+// explainFilter returns how the filter would treat a pod and its nodes.
+func explainFilter(c *config, pod *k8sApi.Pod, nodes *k8sApi.NodeList) *explanation {
+	e := &explanation{
+		Namespace:  pod.Namespace,
+		Pod:        pod.Name,
+		FilterMode: c.Filter.Mode,
+		Strategy:   c.strategy.Name(),
+		Thresholds: thresholds{MaxProjected: c.PodHeat.MaxProjected, Critical: c.Critical.MaxJoules},
+		Nodes:      []nodeExplanation{},
+		Exempt:     c.Exemptions.match(pod),
+	}
+	candidates := readCandidates(c, nodes.Items)
+	classed := withQOS(withClass(c, pod), pod)
+	e.Class = classed.class.name
+	if c.QOS.Enabled {
+		e.QOS = podQOS(pod)
+		e.FilterMode = classed.Filter.Mode
+		e.Strategy = classed.strategy.Name()
+	}
+	e.Thresholds.ClassMax = classed.class.MaxJoules
+	if heat, err := c.PodHeat.projectedHeat(pod); err == nil {
+		e.Thresholds.ProjectedHeat = heat
+	}
+	if c.Budget.MaxWatts > 0 {
+		if budget, err := estimateBudget(c, pod); err == nil {
+			e.Budget = budget
+		}
+	}
+
+	// run the filter with a strategy that does not change and without
+	// recording critical nodes.
+	preview := *c
+	preview.strategy = previewStrategy{c.strategy}
+	preview.dryRun = true
+	f, err := runFilters(&preview, pod, candidates)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	pass := make(map[string]bool)
+	for _, node := range f.passed {
+		pass[node.Name] = true
+	}
+
+	// explain the limit and ranking the filter policy used.
+	scores, chances := make(map[string]float64), make(map[string]float64)
+	if p := f.policy; p != nil {
+		if p.limit != nil && p.warm {
+			floor := -*p.limit
+			e.Thresholds.Floor = &floor
+		} else if p.limit != nil {
+			e.Thresholds.Limit = p.limit
+		}
+		nodes, joules := nodesOf(p.nodes), candidateJoules(p.nodes)
+		e.Groups = groupNodes(p.config, nodes, joules)
+		for i, chance := range groupChances(p.config, nodes, joules, p.ranked) {
+			chances[nodes[i].Name] = chance
+			if p.ranked[i] != math.MaxFloat64 {
+				scores[nodes[i].Name] = p.ranked[i]
+			}
+		}
+	}
+
+	effective := candidateJoules(candidates)
+	for i, node := range candidates {
+		n := nodeExplanation{
+			Node:    node.Name,
+			Group:   groupName(c, &node.Node),
+			Chance:  chances[node.Name],
+			Verdict: verdictReject,
+			Reason:  f.failed[node.Name],
+		}
+		if node.err == nil {
+			joules := node.reading.Joules
+			n.Joules = &joules
+			n.Penalty = node.penalty
+			n.Effective = &effective[i]
+		}
+		if score, ok := scores[node.Name]; ok {
+			n.Score = &score
+		}
+		if pass[node.Name] {
+			n.Verdict = verdictPass
+		}
+		e.Nodes = append(e.Nodes, n)
+	}
+
+	sort.Stable(byScore(e.Nodes))
+	for i := range e.Nodes {
+		e.Nodes[i].Rank = i + 1
+	}
+	return e
+}
+
+// groupChances returns the chance the strategy picks every node from ranked.
+// When nodes are grouped by topology only the nodes of the group the heat
+// class of c prefers have a chance.
+func groupChances(c *config, nodes []k8sApi.Node, joules, ranked []float64) []float64 {
+	groups := groupNodes(c, nodes, joules)
+	if groups == nil {
+		return c.strategy.Chances(ranked)
+	}
+	values := make([]float64, len(groups[0].members))
+	for i, m := range groups[0].members {
+		values[i] = ranked[m]
+	}
+	chances := make([]float64, len(nodes))
+	for i, chance := range c.strategy.Chances(values) {
+		chances[groups[0].members[i]] = chance
+	}
+	return chances
+}
+
+// byScore sorts node explanations by the score the strategy ranks them by.
+// Nodes that did not reach the filter policy follow from cool to warm,
+// unknown joules last.
+type byScore []nodeExplanation
+
+func (b byScore) Len() int      { return len(b) }
+func (b byScore) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byScore) Less(i, j int) bool {
+	if b[i].Score != nil || b[j].Score != nil {
+		if b[i].Score == nil || b[j].Score == nil {
+			return b[i].Score != nil
+		}
+		return *b[i].Score < *b[j].Score
+	}
+	if b[i].Effective == nil || b[j].Effective == nil {
+		return b[j].Effective == nil && b[i].Effective != nil
+	}
+	return *b[i].Effective < *b[j].Effective
+}
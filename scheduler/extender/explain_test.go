@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// TestExplain tests that explain ranks every node with its joules, penalty
+// and verdict without changing any state.
+func TestExplain(t *testing.T) {
+	defer func(l *reservations, a *auditLog) { ledger, audit = l, a }(ledger, audit)
+	now := time.Unix(0, 0)
+	ledger = newReservations(true, time.Hour)
+	ledger.now = fakeClock(&now)
+	audit = newAuditLog(10)
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeBand, Band: 15}
+	c.Reservations.Penalty = 10
+	setConfig(c)
+
+	ledger.reserveJoules("node1", "50", 10)
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{
+		Pod: newPod("web", nil),
+		Nodes: newNodeList(
+			newNode("node1", "50"),
+			newNode("node2", ""),
+			newNode("node3", "55"),
+			newNode("node4", "80"),
+		),
+	})
+	if err != nil {
+		t.Fatalf("Error when trying to convert args to bytes: %v", err)
+	}
+	res, err := http.Post(srv.URL+"/explain", "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatalf("Error when making post request: %v", err)
+	}
+	defer res.Body.Close()
+	e := &explanation{}
+	if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+		t.Fatalf("Error decoding explanation: %v", err)
+	}
+
+	if e.Pod != "web" || e.FilterMode != filterModeBand || e.Strategy != strategyCoolest {
+		t.Errorf("Expected explanation of pod web in band mode but got %+v", e)
+	}
+	if e.Thresholds.Limit == nil || *e.Thresholds.Limit != 70 {
+		t.Errorf("Expected a limit of 70 (55 + 15) but got %v", e.Thresholds.Limit)
+	}
+
+	expected := []struct {
+		node    string
+		penalty float64
+		verdict string
+	}{
+		{"node3", 0, verdictPass},
+		{"node1", 10, verdictPass},
+		{"node4", 0, verdictReject},
+		{"node2", 0, verdictReject},
+	}
+	if len(e.Nodes) != len(expected) {
+		t.Fatalf("Expected %v nodes but got %v", len(expected), len(e.Nodes))
+	}
+	for i, exp := range expected {
+		n := e.Nodes[i]
+		if n.Rank != i+1 || n.Node != exp.node || n.Verdict != exp.verdict {
+			t.Errorf("Rank %v: expected %v with verdict %v but got %+v", i+1, exp.node, exp.verdict, n)
+		}
+		if n.Penalty != exp.penalty {
+			t.Errorf("Rank %v: expected penalty %v but got %v", i+1, exp.penalty, n.Penalty)
+		}
+		if exp.verdict == verdictReject && n.Reason == "" {
+			t.Errorf("Rank %v: expected a reason for rejecting %v", i+1, n.Node)
+		}
+	}
+	if e.Nodes[0].Chance != 1 {
+		t.Errorf("Expected the coolest node to have chance 1 but got %v", e.Nodes[0].Chance)
+	}
+
+	// nothing changed
+	if p := ledger.penaltyFor("node3", "55"); p != 0 {
+		t.Errorf("Expected explain not to reserve heat but node3 has penalty %v", p)
+	}
+	if n := len(audit.decisions("", "")); n != 0 {
+		t.Errorf("Expected explain not to record decisions but got %v", n)
+	}
+}
+
+// TestExplainPolicy tests that explain shows the limit and ranking the filter
+// policy used after the critical cutoff, the heat class and the QoS class of
+// the pod.
+func TestExplainPolicy(t *testing.T) {
+	list := newNodeList(
+		newNode("node1", "10"),
+		newNode("node2", "20"),
+		newNode("node3", "30"),
+		newNode("node4", "200"),
+	)
+	limit := func(joules float64) *float64 { return &joules }
+
+	testCases := map[string]struct {
+		filter   filterPolicy
+		critical float64
+		pod      k8sApi.Pod
+		limit    *float64
+		floor    *float64
+		expected []string
+	}{
+		"critical cutoff": {filterPolicy{Mode: filterModePercentile, Percentile: 100}, 100, newPod("web", nil, "1"), limit(30), nil, []string{"node1", "node2", "node3", "node4"}},
+		"warm class":      {filterPolicy{Mode: filterModePercentile, Percentile: 50}, 0, newClassPod(classTolerant), nil, limit(20), []string{"node3", "node2", "node1", "node4"}},
+		"qos coolest":     {filterPolicy{Mode: filterModeBand, Band: 15}, 0, newQOSPod("web", nil, "4", "4", "1Gi", "1Gi"), nil, nil, []string{"node1", "node2", "node3", "node4"}},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.filter
+		c.Critical = criticalPolicy{MaxJoules: tc.critical}
+		c.HeatClasses.Classes = warmClasses(100)
+		c.QOS = qosPolicy{Enabled: true, StrictCPU: 2, BestEffortClass: classTolerant}
+		e := explainFilter(c, &tc.pod, &list)
+		if (e.Thresholds.Limit == nil) != (tc.limit == nil) || (tc.limit != nil && *e.Thresholds.Limit != *tc.limit) {
+			t.Errorf("Test case %v: expected limit %v but got %v", desc, tc.limit, e.Thresholds.Limit)
+		}
+		if (e.Thresholds.Floor == nil) != (tc.floor == nil) || (tc.floor != nil && *e.Thresholds.Floor != *tc.floor) {
+			t.Errorf("Test case %v: expected floor %v but got %v", desc, tc.floor, e.Thresholds.Floor)
+		}
+		for i, name := range tc.expected {
+			if i >= len(e.Nodes) || e.Nodes[i].Node != name {
+				t.Errorf("Test case %v: expected %v at rank %v but got %+v", desc, name, i+1, e.Nodes)
+				break
+			}
+		}
+	}
+}
+
+// TestExplainRoundRobin tests that explain does not advance a round robin
+// strategy.
+func TestExplainRoundRobin(t *testing.T) {
+	c := defaultConfig()
+	c.strategy, _ = newStrategy(strategyRoundRobin, 2, 0)
+	list := newNodeList(newNode("node1", "50"), newNode("node2", "60"))
+	pod := newPod("web", nil)
+
+	for i := 0; i < 3; i++ {
+		e := explainFilter(c, &pod, &list)
+		if e.Nodes[0].Node != "node1" || e.Nodes[0].Verdict != verdictPass {
+			t.Errorf("Explain %v: expected node1 to pass but got %+v", i, e.Nodes[0])
+		}
+	}
+	nodes, _, err := filterNodes(c, readCandidates(c, list.Items))
+	if err != nil || nodes[0].Name != "node1" {
+		t.Errorf("Expected round robin to still pick node1 first but got %v (%v)", nodes, err)
+	}
+}
+
+// TestExplainMetrics tests that explain leaves the metrics of the filter
+// unchanged, whatever the missing heat policy.
+func TestExplainMetrics(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	list := newNodeList(
+		newNode("node1", "50"),
+		newNode("node2", "150"),
+		newNode("node3", ""),
+	)
+	cachedNodes.replace(list.Items)
+	pod := newPod("web", nil)
+
+	for _, policy := range []string{missingOpen, missingClosed, missingImpute} {
+		c := defaultConfig()
+		c.Missing.Policy = policy
+		c.Critical = criticalPolicy{MaxJoules: 100}
+		c.Budget.MaxWatts = 1000
+
+		counters := []prometheus.Counter{
+			missingHeatTotal.WithLabelValues(policy, actionRankedLast),
+			missingHeatTotal.WithLabelValues(policy, actionRejected),
+			missingHeatTotal.WithLabelValues(policy, actionImputed),
+			budgetRejectedTotal.WithLabelValues("soft"),
+		}
+		gauges := []prometheus.Gauge{criticalNodes, clusterWatts}
+		before := []float64{}
+		for _, counter := range counters {
+			before = append(before, counterValue(t, counter))
+		}
+		for _, gauge := range gauges {
+			before = append(before, gaugeValue(t, gauge))
+		}
+
+		explainFilter(c, &pod, &list)
+
+		after := []float64{}
+		for _, counter := range counters {
+			after = append(after, counterValue(t, counter))
+		}
+		for _, gauge := range gauges {
+			after = append(after, gaugeValue(t, gauge))
+		}
+		for i := range before {
+			if before[i] != after[i] {
+				t.Errorf("Test case %v: expected metric %v to stay at %v but got %v", policy, i, before[i], after[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+const (
+	// filterModeCoolest keeps only the single node picked by the strategy,
+	// by default the coolest node.
+	filterModeCoolest = "coolest"
+	// filterModeCeiling keeps every node below an absolute joules ceiling.
+	filterModeCeiling = "ceiling"
+	// filterModePercentile keeps every node at or below a percentile of the
+	// joules of all candidate nodes.
+	filterModePercentile = "percentile"
+	// filterModeBand keeps every node within a fixed number of joules of the
+	// coolest node.
+	filterModeBand = "band"
+)
+
+// filterPolicy decides which nodes pass the filter.
+type filterPolicy struct {
+	Mode       string  `json:"mode"`
+	MaxJoules  float64 `json:"maxJoules"`  // used by filterModeCeiling
+	Percentile float64 `json:"percentile"` // used by filterModePercentile, between 0 and 100
+	Band       float64 `json:"band"`       // used by filterModeBand
+}
+
+// filterResult is the result of a filter call. It extends ExtenderFilterResult
+// with the nodes that were rejected and the reason why, and with the names of
+// the nodes that pass for requests that carry node names, using the field
+// names that newer versions of the kubernetes scheduler understand.
+type filterResult struct {
+	k8sSchedulerApi.ExtenderFilterResult
+	NodeNames   *[]string         `json:"nodenames,omitempty"`
+	FailedNodes map[string]string `json:"failedNodes,omitempty"`
+}
+
+// validate returns an error if the policy can not be used to filter nodes.
+func (p filterPolicy) validate() error {
+	switch p.Mode {
+	case filterModeCoolest:
+	case filterModeCeiling:
+		if p.MaxJoules <= 0 {
+			return fmt.Errorf("max joules must be positive in %v mode, got %v", p.Mode, p.MaxJoules)
+		}
+	case filterModePercentile:
+		if p.Percentile <= 0 || p.Percentile > 100 {
+			return fmt.Errorf("percentile must be in (0, 100] in %v mode, got %v", p.Mode, p.Percentile)
+		}
+	case filterModeBand:
+		if p.Band < 0 {
+			return fmt.Errorf("band must not be negative in %v mode, got %v", p.Mode, p.Band)
+		}
+	default:
+		return fmt.Errorf("unknown filter mode %q", p.Mode)
+	}
+	return nil
+}
+
+// filterOutcome is the result of running every filter for a pod.
+type filterOutcome struct {
+	passed []candidate       // nodes that pass every filter
+	failed map[string]string // nodes rejected by any filter and the reason why
+	policy *policyOutcome    // result of the filter policy, nil if the pod did not reach it
+}
+
+// policyOutcome is the result of applying the filter policy, with the limit
+// and ranking it used.
+type policyOutcome struct {
+	config *config           // config the policy ran with, holding the heat class, QoS and headroom of the pod
+	nodes  []candidate       // nodes the policy ran on
+	ranked []float64         // values the strategy ranks nodes by, lower is better, see rankValues
+	limit  *float64          // limit of the threshold modes, nil in coolest mode
+	warm   bool              // whether limit applies to the mirrored joules and so is a negated floor
+	passed []candidate       // nodes that pass the policy
+	failed map[string]string // nodes rejected by the policy and the reason why
+}
+
+// filterForPod runs every filter on the nodes a pod can be scheduled on, with
+// the heat read once by readCandidates. It returns the nodes that pass and a
+// map from the name of every rejected node to the reason it was rejected.
+func filterForPod(c *config, pod *k8sApi.Pod, nodes []candidate) ([]candidate, map[string]string, error) {
+	f, err := runFilters(c, pod, nodes)
+	return f.passed, f.failed, err
+}
+
+// runFilters runs every filter for a pod like filterForPod and returns the
+// outcome of every filter, so explain shows what the filters applied.
+func runFilters(c *config, pod *k8sApi.Pod, nodes []candidate) (filterOutcome, error) {
+	if len(nodes) == 0 {
+		return filterOutcome{}, fmt.Errorf("No nodes were provided")
+	}
+
+	// nodes above the critical level never pass, whatever the pod.
+	eligible, failed, err := filterCritical(c, nodes)
+	if err != nil {
+		return filterOutcome{failed: failed}, err
+	}
+
+	// pods that would exceed the power budget never pass, exempt or not. The
+	// budget covers every node, including the ones above the critical level.
+	budgetFailed, err := filterBudget(c, pod, nodes)
+	for name, reason := range budgetFailed {
+		failed[name] = reason
+	}
+	if err != nil {
+		return filterOutcome{failed: failed}, err
+	}
+
+	// exempt pods are not filtered on heat otherwise.
+	if x := c.Exemptions.match(pod); x != nil {
+		debugf("Passing all %v eligible nodes for pod %v exempt by %v (%v)", len(eligible), pod.Name, x.Rule, x.Action)
+		return filterOutcome{passed: eligible, failed: failed}, nil
+	}
+	c = withQOS(withClass(c, pod), pod)
+
+	// handle nodes without heat according to the missing heat policy.
+	m, err := applyMissing(c, pod, eligible)
+	for name, reason := range m.failed {
+		failed[name] = reason
+	}
+	if err != nil {
+		return filterOutcome{failed: failed}, err
+	}
+	if m.passAll {
+		return filterOutcome{passed: eligible, failed: failed}, nil
+	}
+
+	// drop nodes the pod would heat beyond the max projected joules.
+	projected, projectedFailed, err := filterProjected(c, m.nodes, pod)
+	if err != nil {
+		return filterOutcome{failed: failed}, err
+	}
+	for name, reason := range projectedFailed {
+		failed[name] = reason
+	}
+	if len(projected) == 0 {
+		return filterOutcome{failed: failed}, fmt.Errorf("all %v nodes would exceed the max projected joules of %v", len(m.nodes), c.PodHeat.MaxProjected)
+	}
+
+	// drop nodes above the limit of the heat class of the pod.
+	classed, classFailed := filterClass(c, projected)
+	for name, reason := range classFailed {
+		failed[name] = reason
+	}
+	if len(classed) == 0 {
+		return filterOutcome{failed: failed}, fmt.Errorf("all %v nodes exceed the limit of %v joules of heat class %v", len(projected), c.class.MaxJoules, c.class.name)
+	}
+
+	// apply the filter policy to the remaining nodes, ranking them by heat
+	// and headroom in the direction the heat class prefers.
+	p, err := applyPolicy(withHeadroom(c, pod), classed)
+	for name, reason := range p.failed {
+		failed[name] = reason
+	}
+	f := filterOutcome{failed: failed, policy: &p}
+	if err != nil {
+		return f, err
+	}
+	f.passed = p.passed
+	return f, nil
+}
+
+// filterNodes splits a list of nodes into the nodes that pass the filter
+// policy and a map from the name of every rejected node to the reason it was
+// rejected.
+func filterNodes(c *config, nodes []candidate) ([]candidate, map[string]string, error) {
+	p, err := applyPolicy(c, nodes)
+	return p.passed, p.failed, err
+}
+
+// applyPolicy applies the filter policy to nodes like filterNodes and returns
+// the outcome with the limit and ranking it used.
+func applyPolicy(c *config, nodes []candidate) (policyOutcome, error) {
+	p := policyOutcome{config: c, nodes: nodes, failed: make(map[string]string)}
+	if len(nodes) == 0 {
+		return p, fmt.Errorf("No nodes were provided")
+	}
+	joules := candidateJoules(nodes)
+	p.ranked = rankValues(c, nodesOf(nodes), rankJoules(c, nodes))
+
+	failed := p.failed
+	if c.Filter.Mode == filterModeCoolest {
+		picked := pickNode(c, nodes, p.ranked)
+		selected := nodes[picked]
+		group, than := groupName(c, &selected.Node), "warmer"
+		if c.prefersWarm() {
+			than = "cooler"
+		}
+		for i, node := range nodes {
+			switch {
+			case i == picked:
+			case c.Topology.Key != "" && groupName(c, &node.Node) != group:
+				failed[node.Name] = fmt.Sprintf("node is in %v group %q, which is %v than group %q", c.Topology.Key, groupName(c, &node.Node), than, group)
+			default:
+				failed[node.Name] = fmt.Sprintf("node was not picked by the %v strategy (joules=%v)", c.strategy.Name(), formatJoules(joules[i]))
+			}
+		}
+		p.passed = []candidate{selected}
+		return p, nil
+	}
+
+	// compute the highest joules value a node may have to pass. Pods of a
+	// heat class preferring warm nodes keep the warm end of the percentile
+	// or band, so their limit is computed on the mirrored joules.
+	warm := c.prefersWarm() && c.Filter.Mode != filterModeCeiling
+	scores := joules
+	if warm {
+		scores = mirrorJoules(rankJoules(c, nodes))
+	}
+	limit, err := joulesLimit(c, scores)
+	if err != nil {
+		return p, err
+	}
+	p.limit, p.warm = &limit, warm
+
+	passed := []candidate{}
+	for i, node := range nodes {
+		switch {
+		case joules[i] == math.MaxFloat64:
+			failed[node.Name] = fmt.Sprintf("node has no valid heat in %v to compare with the %v limit", c.source.Name(), c.Filter.Mode)
+		case warm && scores[i] > limit:
+			failed[node.Name] = fmt.Sprintf("node joules %v are below the %v limit of %v of heat class %v", -scores[i], c.Filter.Mode, -limit, c.class.name)
+		case scores[i] > limit:
+			failed[node.Name] = fmt.Sprintf("node joules %v exceed the %v limit of %v", joules[i], c.Filter.Mode, limit)
+		default:
+			passed = append(passed, node)
+		}
+	}
+
+	if len(passed) == 0 {
+		return p, fmt.Errorf("No suitable nodes found.")
+	}
+	p.passed = passed
+	return p, nil
+}
+
+// joulesLimit returns the highest joules value a node may have to pass the
+// filter policy, given the joules of all candidate nodes as returned by
+// candidateJoules.
+func joulesLimit(c *config, scores []float64) (float64, error) {
+	p := c.Filter
+	if p.Mode == filterModeCeiling {
+		return p.MaxJoules, nil
+	}
+
+	// collect the joules of all nodes with valid heat
+	joules := make([]float64, 0, len(scores))
+	for _, j := range scores {
+		if j != math.MaxFloat64 {
+			joules = append(joules, j)
+		}
+	}
+	if len(joules) == 0 {
+		return 0, fmt.Errorf("No node has valid heat in %v", c.source.Name())
+	}
+	sort.Float64s(joules)
+
+	switch p.Mode {
+	case filterModePercentile:
+		// nearest-rank percentile
+		rank := int(math.Ceil(p.Percentile / 100 * float64(len(joules))))
+		if rank < 1 {
+			rank = 1
+		}
+		return joules[rank-1], nil
+	case filterModeBand:
+		return joules[0] + p.Band, nil
+	}
+	return 0, fmt.Errorf("unknown filter mode %q", p.Mode)
+}
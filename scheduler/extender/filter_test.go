@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// TestFilterNodes tests filterNodes using different policies.
+func TestFilterNodes(t *testing.T) {
+	list := newNodeList(
+		newNode("node1", "50"),
+		newNode("node2", "60"),
+		newNode("node3", "70"),
+		newNode("node4", "80"),
+		newNode("node5", ""),
+	)
+	testCases := map[string]struct {
+		policy   filterPolicy
+		expected []string
+	}{
+		"coolest": {
+			policy:   filterPolicy{Mode: filterModeCoolest},
+			expected: []string{"node1"},
+		},
+		"ceiling": {
+			policy:   filterPolicy{Mode: filterModeCeiling, MaxJoules: 65},
+			expected: []string{"node1", "node2"},
+		},
+		"percentile": {
+			policy:   filterPolicy{Mode: filterModePercentile, Percentile: 75},
+			expected: []string{"node1", "node2", "node3"},
+		},
+		"band": {
+			policy:   filterPolicy{Mode: filterModeBand, Band: 10},
+			expected: []string{"node1", "node2"},
+		},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.policy
+		nodes, failed, err := filterNodes(c, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Error when testing case %v: %v", desc, err)
+			continue
+		}
+		if len(nodes) != len(tc.expected) {
+			t.Errorf("Test case %v: expected %v nodes but got %v", desc, len(tc.expected), len(nodes))
+			continue
+		}
+		for i, node := range nodes {
+			if node.Name != tc.expected[i] {
+				t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected[i], node.Name)
+			}
+		}
+		if len(failed)+len(nodes) != len(list.Items) {
+			t.Errorf("Test case %v: expected a reason for all %v rejected nodes but got %v", desc, len(list.Items)-len(nodes), len(failed))
+		}
+		if tc.policy.Mode == filterModeCoolest && !strings.Contains(failed["node5"], "joules=unknown") {
+			t.Errorf("Test case %v: expected node5 to be rejected with unknown joules but got %q", desc, failed["node5"])
+		}
+	}
+}
+
+// TestFilterNodesFail tests the cases in which no node passes the filter.
+func TestFilterNodesFail(t *testing.T) {
+	testCases := map[string]struct {
+		list   k8sApi.NodeList
+		policy filterPolicy
+	}{
+		"empty list": {
+			list:   newNodeList(),
+			policy: filterPolicy{Mode: filterModeBand},
+		},
+		"all above ceiling": {
+			list:   newNodeList(newNode("node1", "50"), newNode("node2", "60")),
+			policy: filterPolicy{Mode: filterModeCeiling, MaxJoules: 40},
+		},
+		"no joules": {
+			list:   newNodeList(newNode("node1", ""), newNode("node2", "illigal")),
+			policy: filterPolicy{Mode: filterModePercentile, Percentile: 50},
+		},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.policy
+		_, _, err := filterNodes(c, readCandidates(c, tc.list.Items))
+		if err == nil {
+			t.Errorf("Test case %v: expected error", desc)
+		}
+	}
+}
+
+// TestFilterPolicyValidate tests that invalid policies are rejected.
+func TestFilterPolicyValidate(t *testing.T) {
+	testCases := map[string]struct {
+		policy filterPolicy
+		valid  bool
+	}{
+		"coolest":            {filterPolicy{Mode: filterModeCoolest}, true},
+		"ceiling":            {filterPolicy{Mode: filterModeCeiling, MaxJoules: 10}, true},
+		"ceiling zero":       {filterPolicy{Mode: filterModeCeiling}, false},
+		"percentile too big": {filterPolicy{Mode: filterModePercentile, Percentile: 101}, false},
+		"negative band":      {filterPolicy{Mode: filterModeBand, Band: -1}, false},
+		"unknown mode":       {filterPolicy{Mode: "hottest"}, false},
+	}
+
+	for desc, tc := range testCases {
+		err := tc.policy.validate()
+		if tc.valid && err != nil {
+			t.Errorf("Test case %v: expected valid policy but got %v", desc, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("Test case %v: expected invalid policy", desc)
+		}
+	}
+}
@@ -2,43 +2,262 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	k8sApi "k8s.io/kubernetes/pkg/api"
 	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
 )
 
+// errBodyTooLarge is returned when a request body without a content length
+// passes the size limit of the server.
+var errBodyTooLarge = errors.New("request body exceeds the size limit")
+
+// errorResponse is returned by prioritize when a request can not be handled,
+// HostPriorityList has no field to carry an error.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
 // handler handles a request from the kubernetes scheduler.
-// handler receives a list of nodes and a pod and returns the node with the
-// lowest joules label.
+// handler receives a list of nodes and a pod and returns the nodes that pass
+// the filter policy, by default only the node with the lowest joules label.
+// Malformed requests are answered with status 400, when no node passes the
+// filter the result carries an error so the scheduler reports why.
 func handler(w http.ResponseWriter, r *http.Request) {
+	c := currentConfig()
+	start, outcome := time.Now(), outcomeSuccess
+	defer func() { observeRequest(verbFilter, outcome, start) }()
+
 	// decode request body.
-	dec := json.NewDecoder(r.Body)
-	received := &k8sSchedulerApi.ExtenderArgs{}
-	err := dec.Decode(received)
+	received, err := decodeArgs(c, r)
 	if err != nil {
-		fmt.Printf("Error when trying to decode response body to struct: %v\n", err)
+		errorf("Error when trying to decode request body: %v", err)
+		outcome = outcomeBadRequest
+		writeJSON(w, decodeStatus(err), &filterResult{
+			ExtenderFilterResult: k8sSchedulerApi.ExtenderFilterResult{
+				Error: err.Error(),
+			},
+		})
 		return
 	}
 
-	logNodes(&received.Nodes)
+	// read the heat of every node once.
+	candidates := readCandidates(c, received.Nodes.Items)
+	logNodes(c, candidates)
+	status.record(c, candidates)
+	observeNodes(c, verbFilter, candidates)
+
+	// select the nodes to schedule on.
+	nodes, failed, err := filterForPod(c, &received.Pod, candidates)
+	result := &filterResult{
+		ExtenderFilterResult: k8sSchedulerApi.ExtenderFilterResult{
+			Nodes: k8sApi.NodeList{
+				Items: nodesOf(nodes),
+			},
+		},
+		FailedNodes: failed,
+	}
+	if err != nil {
+		errorf("Encountered error when selecting node for pod %v: %v", received.Pod.Name, err)
+		outcome = outcomeError
+		if len(failed) > 0 {
+			outcome = outcomeNoNodes
+		}
+		result.Nodes.Items = []k8sApi.Node{}
+		result.Error = fmt.Sprintf("heat scheduler could not select a node for pod %v: %v", received.Pod.Name, err)
+	}
+	if received.NodeNames != nil {
+		// answer names with names.
+		result.NodeNames = nodeNames(result.Nodes.Items)
+		result.Nodes.Items = nil
+	}
+
+	// record the decision before the reservation changes the penalties.
+	d := newDecision(c, verbFilter, &received.Pod, candidates)
+	for _, node := range nodes {
+		d.Chosen = append(d.Chosen, node.Name)
+	}
+	d.Dropped = failed
+	d.Error = result.Error
+	audit.record(d)
+	observeExempt(verbFilter, d.Exempt)
+
+	// the pod passed, so it counts against the power budget whatever node
+	// it lands on.
+	if err == nil {
+		admitBudget(c, &received.Pod)
+	}
+
+	// a single remaining node is where the pod will land, reserve heat on it
+	// until the heat source publishes a new value. With several remaining
+	// nodes prioritize reserves on the top scored one.
+	if len(nodes) == 1 && nodes[0].err == nil {
+		ledger.reserveJoules(nodes[0].Name, nodes[0].reading.Version, reservedHeat(c, &received.Pod))
+	}
 
-	// select the node to schedule on.
-	nodes, err := selectNode(&received.Nodes)
+	// return the result.
+	writeJSON(w, http.StatusOK, result)
+	observeChosen(nodes)
+	for _, node := range nodes {
+		infof("Chose node %v (joules=%v) for pod %v", node.Name, node.joules(), received.Pod.Name)
+	}
+}
+
+// prioritize handles a prioritize request from the kubernetes scheduler.
+// prioritize receives a list of nodes and a pod and returns a score for every
+// node, where cooler nodes receive a higher score unless the heat class of the
+// pod prefers warm nodes. An empty list of nodes
+// results in an empty list of scores. When the filter passed several nodes,
+// as the threshold modes do, heat is reserved on the top scored node.
+func prioritize(w http.ResponseWriter, r *http.Request) {
+	c := currentConfig()
+	start, outcome := time.Now(), outcomeSuccess
+	defer func() { observeRequest(verbPrioritize, outcome, start) }()
+
+	// decode request body.
+	received, err := decodeArgs(c, r)
+	if err != nil {
+		errorf("Error when trying to decode request body: %v", err)
+		outcome = outcomeBadRequest
+		writeJSON(w, decodeStatus(err), &errorResponse{Error: err.Error()})
+		return
+	}
+
+	// read the heat of every node once.
+	candidates := readCandidates(c, received.Nodes.Items)
+	logNodes(c, candidates)
+	status.record(c, candidates)
+	observeNodes(c, verbPrioritize, candidates)
+
+	// score the nodes, heat is ignored for pods exempt by bypass.
+	priorities := k8sSchedulerApi.HostPriorityList{}
+	x := c.Exemptions.match(&received.Pod)
+	if x != nil && x.Action == exemptBypass {
+		for _, node := range received.Nodes.Items {
+			priorities = append(priorities, k8sSchedulerApi.HostPriority{Host: node.Name})
+		}
+	} else if len(received.Nodes.Items) > 0 {
+		// nodes are scored in the direction the heat class of the pod
+		// prefers, nodes without heat are scored with the median of their
+		// peers when the missing heat policy imputes.
+		pc := withQOS(withClass(c, &received.Pod), &received.Pod)
+		scored := candidates
+		if c.Missing.policyFor(received.Pod.Namespace) == missingImpute {
+			scored = imputeMissing(candidates)
+		}
+		priorities, err = prioritizeNodes(withHeadroom(pc, &received.Pod), scored)
+	}
+
+	d := newDecision(c, verbPrioritize, &received.Pod, candidates)
+	d.Scores = make(map[string]int, len(priorities))
+	for _, hp := range priorities {
+		d.Scores[hp.Host] = hp.Score
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	audit.record(d)
+	observeExempt(verbPrioritize, d.Exempt)
 	if err != nil {
-		fmt.Printf("Encountered error when selecting node: %v", err)
+		errorf("Encountered error when prioritizing nodes: %v", err)
+		outcome = outcomeError
+		writeJSON(w, http.StatusInternalServerError, &errorResponse{Error: err.Error()})
+		return
+	}
+
+	// with several candidates the filter reserved nothing, the top scored
+	// node is where the pod most likely lands, so heat is reserved on it.
+	if len(candidates) > 1 && (x == nil || x.Action != exemptBypass) {
+		reserveTop(c, &received.Pod, candidates, priorities)
 	}
 
 	// return the result.
-	enc := json.NewEncoder(w)
+	writeJSON(w, http.StatusOK, &priorities)
+	infof("Prioritized %v nodes for pod %v", len(priorities), received.Pod.Name)
+}
+
+// reserveTop reserves the heat of pod on the node with the highest score, the
+// first one on a tie. Nodes without heat are never reserved on.
+func reserveTop(c *config, pod *k8sApi.Pod, nodes []candidate, priorities k8sSchedulerApi.HostPriorityList) {
+	top := -1
+	for i, hp := range priorities {
+		if top == -1 || hp.Score > priorities[top].Score {
+			top = i
+		}
+	}
+	if top == -1 || nodes[top].err != nil {
+		return
+	}
+	ledger.reserveJoules(nodes[top].Name, nodes[top].reading.Version, reservedHeat(c, pod))
+}
+
+// extenderArgs extends ExtenderArgs with the node names that newer versions
+// of the kubernetes scheduler send instead of the nodes to an extender
+// configured with nodeCacheCapable.
+type extenderArgs struct {
+	k8sSchedulerApi.ExtenderArgs
+	NodeNames *[]string `json:"nodenames,omitempty"`
+}
+
+// decodeArgs decodes the ExtenderArgs in the body of a request. When the
+// request carries node names, the nodes are resolved from the node cache.
+func decodeArgs(c *config, r *http.Request) (*extenderArgs, error) {
+	if r.Body == nil {
+		return nil, fmt.Errorf("request has no body")
+	}
+	args := &extenderArgs{}
+	err := json.NewDecoder(r.Body).Decode(args)
+	if err == io.EOF {
+		return nil, fmt.Errorf("request body is empty")
+	}
+	if _, ok := err.(*http.MaxBytesError); ok {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("request body is not valid ExtenderArgs: %v", err)
+	}
+	if args.NodeNames == nil {
+		return args, nil
+	}
+	if !c.NodeCache.Enabled {
+		return nil, fmt.Errorf("request carries node names but the node cache is disabled")
+	}
+	if args.Nodes.Items, err = cachedNodes.lookup(*args.NodeNames); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// decodeStatus returns the status code of a request that decodeArgs failed
+// on. A node cache that is not synced yet is a temporary failure.
+func decodeStatus(err error) int {
+	switch err {
+	case errNodeCacheNotSynced:
+		return http.StatusServiceUnavailable
+	case errBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// nodeNames returns the names of nodes.
+func nodeNames(nodes []k8sApi.Node) *[]string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+	}
+	return &names
+}
+
+// writeJSON writes v as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	enc.Encode(&k8sSchedulerApi.ExtenderFilterResult{
-		Nodes: k8sApi.NodeList{
-			Items: nodes,
-		},
-	})
-	fmt.Printf("Chose node %v (joules=%v) for pod %v\n", nodes[0].Name, nodes[0].Labels["joules"], received.Pod.Name)
-	return
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errorf("Error when trying to encode response: %v", err)
+	}
 }
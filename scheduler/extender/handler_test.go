@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
@@ -60,3 +61,261 @@ func TestHandler(t *testing.T) {
 		t.Errorf("Expected node %v to be scheduled but %v was chosen", expected, received.Nodes.Items[0].Name)
 	}
 }
+
+// TestPrioritize tests the prioritize function.
+func TestPrioritize(t *testing.T) {
+	// New test server
+	srv := httptest.NewServer(http.HandlerFunc(prioritize))
+	defer srv.Close()
+
+	// Input to send for test and expected scores
+	expected := map[string]int{
+		"node1": 10,
+		"node2": 3,
+		"node3": 0,
+		"node4": 0,
+	}
+	args := &k8sSchedulerApi.ExtenderArgs{
+		Pod: k8sApi.Pod{},
+		Nodes: newNodeList(
+			newNode("node1", "50.5"),
+			newNode("node2", "70.5"),
+			newNode("node3", "80.5"),
+			newNode("node4", ""),
+		),
+	}
+
+	// convert to json
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Errorf("Error when trying to convert args to bytes: %v", err)
+		return
+	}
+	// send request to fake server
+	res, err := http.Post(srv.URL, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		t.Errorf("Error when making post request: %v", err)
+		return
+	}
+
+	// decode result from fake server
+	dec := json.NewDecoder(res.Body)
+	received := k8sSchedulerApi.HostPriorityList{}
+	err = dec.Decode(&received)
+	if err != nil {
+		t.Errorf("Error when trying to convert result to HostPriorityList: %v", err)
+		return
+	}
+
+	// handle result
+	if len(received) != len(expected) {
+		t.Errorf("Expected %v scores but received %v", len(expected), len(received))
+		return
+	}
+	for _, hp := range received {
+		if hp.Score != expected[hp.Host] {
+			t.Errorf("Expected node %v to have score %v but got %v", hp.Host, expected[hp.Host], hp.Score)
+		}
+	}
+}
+
+// TestHandlerErrors tests how handler and prioritize respond to requests
+// they can not fully serve.
+func TestHandlerErrors(t *testing.T) {
+	emptyArgs, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{})
+	if err != nil {
+		t.Errorf("Error when trying to convert args to bytes: %v", err)
+		return
+	}
+	hotArgs, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{
+		Nodes: newNodeList(
+			newNode("node1", "50.5"),
+			newNode("node2", ""),
+		),
+	})
+	if err != nil {
+		t.Errorf("Error when trying to convert args to bytes: %v", err)
+		return
+	}
+
+	testCases := map[string]struct {
+		handler      http.HandlerFunc
+		policy       filterPolicy
+		body         []byte
+		expectedCode int
+		expectError  bool
+		expectFailed int
+	}{
+		"filter malformed json": {
+			handler:      handler,
+			body:         []byte(`{"nodes":`),
+			expectedCode: http.StatusBadRequest,
+			expectError:  true,
+		},
+		"filter wrong type": {
+			handler:      handler,
+			body:         []byte(`{"nodes": "node1"}`),
+			expectedCode: http.StatusBadRequest,
+			expectError:  true,
+		},
+		"filter empty body": {
+			handler:      handler,
+			body:         []byte{},
+			expectedCode: http.StatusBadRequest,
+			expectError:  true,
+		},
+		"filter empty node list": {
+			handler:      handler,
+			body:         emptyArgs,
+			expectedCode: http.StatusOK,
+			expectError:  true,
+		},
+		"filter no node passes": {
+			handler:      handler,
+			policy:       filterPolicy{Mode: filterModeCeiling, MaxJoules: 10},
+			body:         hotArgs,
+			expectedCode: http.StatusOK,
+			expectError:  true,
+			expectFailed: 2,
+		},
+		"prioritize malformed json": {
+			handler:      prioritize,
+			body:         []byte(`not json`),
+			expectedCode: http.StatusBadRequest,
+			expectError:  true,
+		},
+		"prioritize empty body": {
+			handler:      prioritize,
+			body:         []byte{},
+			expectedCode: http.StatusBadRequest,
+			expectError:  true,
+		},
+		"prioritize empty node list": {
+			handler:      prioritize,
+			body:         emptyArgs,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	defer setConfig(currentConfig())
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		if tc.policy.Mode != "" {
+			c.Filter = tc.policy
+		}
+		setConfig(c)
+
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/", bytes.NewBuffer(tc.body))
+		if err != nil {
+			t.Errorf("Test case %v: error creating request: %v", desc, err)
+			continue
+		}
+		tc.handler(rec, req)
+
+		if rec.Code != tc.expectedCode {
+			t.Errorf("Test case %v: expected status %v but got %v", desc, tc.expectedCode, rec.Code)
+		}
+		// both filterResult and errorResponse carry the error in the error field
+		received := &filterResult{}
+		if err := json.Unmarshal(rec.Body.Bytes(), received); err != nil && tc.expectError {
+			t.Errorf("Test case %v: error decoding response %q: %v", desc, rec.Body.String(), err)
+			continue
+		}
+		if tc.expectError && received.Error == "" {
+			t.Errorf("Test case %v: expected an error message in the response", desc)
+		}
+		if !tc.expectError && received.Error != "" {
+			t.Errorf("Test case %v: expected no error but got %v", desc, received.Error)
+		}
+		if len(received.FailedNodes) != tc.expectFailed {
+			t.Errorf("Test case %v: expected %v failed nodes but got %v", desc, tc.expectFailed, len(received.FailedNodes))
+		}
+	}
+}
+
+// TestHandlerNodeNames tests that requests carrying node names are resolved
+// from the node cache and answered with node names.
+func TestHandlerNodeNames(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.NodeCache.Enabled = true
+	setConfig(c)
+
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+	body := `{"pod": {}, "nodenames": ["node1", "node2", "node3"]}`
+
+	// the scheduler retries once the cache is synced.
+	res, err := http.Post(srv.URL+"/filter", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Error when making post request: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %v before the cache is synced but got %v", http.StatusServiceUnavailable, res.StatusCode)
+	}
+
+	cachedNodes.replace([]k8sApi.Node{newNode("node1", "70.5"), newNode("node2", "50.5")})
+	res, err = http.Post(srv.URL+"/filter", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Error when making post request: %v", err)
+	}
+	defer res.Body.Close()
+	received := &filterResult{}
+	if err := json.NewDecoder(res.Body).Decode(received); err != nil {
+		t.Fatalf("Error when trying to decode result: %v", err)
+	}
+	if received.NodeNames == nil || len(*received.NodeNames) != 1 || (*received.NodeNames)[0] != "node2" {
+		t.Errorf("Expected node names [node2] but got %v", received.NodeNames)
+	}
+	if len(received.Nodes.Items) != 0 {
+		t.Errorf("Expected no nodes in a node names answer but got %v", len(received.Nodes.Items))
+	}
+	if len(received.FailedNodes) != 2 {
+		t.Errorf("Expected node1 and the unknown node3 to fail but got %v", received.FailedNodes)
+	}
+
+	c = defaultConfig()
+	setConfig(c)
+	res, err = http.Post(srv.URL+"/prioritize", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Error when making post request: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %v with the node cache disabled but got %v", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+// marshalArgs returns the JSON encoding of ExtenderArgs holding nodes.
+func marshalArgs(t testing.TB, nodes k8sApi.NodeList) []byte {
+	b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{Nodes: nodes})
+	if err != nil {
+		t.Fatalf("Error when trying to convert args to bytes: %v", err)
+	}
+	return b
+}
+
+// BenchmarkHandler measures a filter request from decoding the payload to
+// encoding the result, on clusters of 1k and 5k nodes.
+func BenchmarkHandler(b *testing.B) {
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.LogLevel = "error"
+	setConfig(c)
+
+	for _, n := range []int{1000, 5000} {
+		body := marshalArgs(b, newCluster(n))
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest("POST", "/filter", bytes.NewReader(body))
+				handler(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
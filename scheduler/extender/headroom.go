@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// headroomPolicy blends heat with the resource utilisation of nodes, so heat
+// spreading does not pile pods onto a cool but nearly full node. The blend
+// decides the ranking of the coolest mode and of prioritize, the threshold
+// modes keep comparing joules.
+type headroomPolicy struct {
+	Weight    float64 `json:"weight"`    // share of utilisation in the ranking from 0 to 1, 0 disables the pod watch
+	APIServer string  `json:"apiServer"` // address of the API server the pods are watched on, empty uses the in-cluster config
+}
+
+// validate returns an error if the weight is not a share.
+func (p headroomPolicy) validate() error {
+	if p.Weight < 0 || p.Weight > 1 {
+		return fmt.Errorf("weight must be between 0 and 1, got %v", p.Weight)
+	}
+	return nil
+}
+
+// usage is the CPU and memory requested by pods.
+type usage struct {
+	cpu    int64 // milli CPUs
+	memory int64 // bytes
+}
+
+// podRequests returns the CPU and memory requested by all containers of a pod.
+func podRequests(pod *k8sApi.Pod) usage {
+	u := usage{}
+	for _, c := range pod.Spec.Containers {
+		u.cpu += c.Resources.Requests.Cpu().MilliValue()
+		u.memory += c.Resources.Requests.Memory().Value()
+	}
+	return u
+}
+
+// podCache tracks the requests of the pods bound to every node. It is kept
+// up to date by a podWatcher.
+type podCache struct {
+	mu     sync.RWMutex     // guards the fields below
+	pods   map[string]bound // pods by namespace/name
+	nodes  map[string]usage // requests of the pods bound to a node by node name
+	synced bool             // whether the cache holds a full list of pods
+}
+
+// bound is a pod bound to a node.
+type bound struct {
+	node     string
+	requests usage
+}
+
+// pods is the pod cache shared by all handlers.
+var pods = newPodCache()
+
+// newPodCache returns an empty pod cache that is not synced.
+func newPodCache() *podCache {
+	return &podCache{pods: make(map[string]bound), nodes: make(map[string]usage)}
+}
+
+// replace replaces the content of the cache with a full list of pods and
+// marks the cache synced.
+func (p *podCache) replace(list []k8sApi.Pod) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pods = make(map[string]bound)
+	p.nodes = make(map[string]usage)
+	for i := range list {
+		p.add(&list[i])
+	}
+	p.synced = true
+}
+
+// update adds, updates or removes a pod.
+func (p *podCache) update(pod *k8sApi.Pod, deleted bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remove(podKey(pod))
+	if !deleted {
+		p.add(pod)
+	}
+}
+
+// add adds a pod that is bound to a node and not finished, p.mu must be held.
+func (p *podCache) add(pod *k8sApi.Pod) {
+	if pod.Spec.NodeName == "" || pod.Status.Phase == k8sApi.PodSucceeded || pod.Status.Phase == k8sApi.PodFailed {
+		return
+	}
+	b := bound{node: pod.Spec.NodeName, requests: podRequests(pod)}
+	p.pods[podKey(pod)] = b
+	n := p.nodes[b.node]
+	n.cpu += b.requests.cpu
+	n.memory += b.requests.memory
+	p.nodes[b.node] = n
+}
+
+// remove removes a pod by key, p.mu must be held.
+func (p *podCache) remove(key string) {
+	b, ok := p.pods[key]
+	if !ok {
+		return
+	}
+	delete(p.pods, key)
+	n := p.nodes[b.node]
+	n.cpu -= b.requests.cpu
+	n.memory -= b.requests.memory
+	if n.cpu == 0 && n.memory == 0 {
+		delete(p.nodes, b.node)
+		return
+	}
+	p.nodes[b.node] = n
+}
+
+// podKey returns the key of a pod in the cache.
+func podKey(pod *k8sApi.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// utilisation returns the highest share of allocatable CPU or memory of node
+// that is requested once pod is placed on it. It returns false when the cache
+// is not synced or the node reports no allocatable resources.
+func (p *podCache) utilisation(node *k8sApi.Node, pod *k8sApi.Pod) (float64, bool) {
+	cpu := node.Status.Allocatable.Cpu().MilliValue()
+	memory := node.Status.Allocatable.Memory().Value()
+	if cpu == 0 && memory == 0 {
+		return 0, false
+	}
+
+	p.mu.RLock()
+	used, synced := p.nodes[node.Name], p.synced
+	p.mu.RUnlock()
+	if !synced {
+		return 0, false
+	}
+
+	req := podRequests(pod)
+	u := 0.0
+	if cpu > 0 {
+		u = math.Max(u, float64(used.cpu+req.cpu)/float64(cpu))
+	}
+	if memory > 0 {
+		u = math.Max(u, float64(used.memory+req.memory)/float64(memory))
+	}
+	return u, true
+}
+
+// withHeadroom returns a copy of c that ranks nodes by the blend of heat and
+// the utilisation after placing pod. c is returned when the weight is 0.
+func withHeadroom(c *config, pod *k8sApi.Pod) *config {
+	if c.Headroom.Weight == 0 {
+		return c
+	}
+	blended := *c
+	blended.utilisation = func(node *k8sApi.Node) (float64, bool) {
+		return pods.utilisation(node, pod)
+	}
+	return &blended
+}
+
+// rankValues returns the values nodes are ranked by, lower is better. Without
+// headroom these are the joules. With headroom the joules are scaled to 0 for
+// the coolest and 1 for the warmest node and blended with the utilisation,
+// nodes with unknown utilisation are ranked by heat alone. The blend is mapped
+// back onto the joules of the nodes so the strategies weigh it like joules.
+// For pods of a heat class preferring warm nodes the scale of the joules is
+// reversed. Nodes without heat keep the max float value.
+func rankValues(c *config, nodes []k8sApi.Node, joules []float64) []float64 {
+	warm := c.prefersWarm()
+	if c.utilisation == nil && !warm {
+		return joules
+	}
+
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	for _, j := range joules {
+		if j != math.MaxFloat64 {
+			min = math.Min(min, j)
+			max = math.Max(max, j)
+		}
+	}
+
+	// nodes of equal heat are spread over the joules of the coolest node.
+	span := max - min
+	if span == 0 {
+		span = math.Max(min, 1)
+	}
+
+	w := c.Headroom.Weight
+	if c.utilisation == nil {
+		w = 0
+	}
+	values := make([]float64, len(joules))
+	for i, j := range joules {
+		if j == math.MaxFloat64 {
+			values[i] = j
+			continue
+		}
+		heat := 0.0
+		if max > min {
+			heat = (j - min) / (max - min)
+		}
+		if warm {
+			heat = 1 - heat
+		}
+		u, ok := heat, false
+		if c.utilisation != nil {
+			u, ok = c.utilisation(&nodes[i])
+		}
+		if !ok {
+			u = heat
+		}
+		values[i] = min + ((1-w)*heat+w*u)*span
+	}
+	return values
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// TestPodCache tests that the requests of bound pods are tracked per node.
+func TestPodCache(t *testing.T) {
+	cache := newPodCache()
+	node := newSizedNode("node1", "50", "4", "8Gi")
+	pod := newPod("new", nil, "1")
+
+	if _, ok := cache.utilisation(&node, &pod); ok {
+		t.Errorf("Expected no utilisation before the cache is synced")
+	}
+
+	cache.replace([]k8sApi.Pod{
+		newBoundPod("a", "node1", "1"),
+		newBoundPod("b", "node2", "2"),
+		newPod("pending", nil, "1"),
+	})
+	testCases := []struct {
+		desc     string
+		update   func()
+		expected float64
+	}{
+		{"listed", func() {}, 0.5},
+		{"added", func() { p := newBoundPod("c", "node1", "1"); cache.update(&p, false) }, 0.75},
+		{"modified", func() { p := newBoundPod("c", "node1", "500m"); cache.update(&p, false) }, 0.625},
+		{"finished", func() {
+			p := newBoundPod("c", "node1", "500m")
+			p.Status.Phase = k8sApi.PodSucceeded
+			cache.update(&p, false)
+		}, 0.5},
+		{"deleted", func() { p := newBoundPod("a", "node1", "1"); cache.update(&p, true) }, 0.25},
+	}
+
+	for _, tc := range testCases {
+		tc.update()
+		u, ok := cache.utilisation(&node, &pod)
+		if !ok || u != tc.expected {
+			t.Errorf("Test case %v: expected utilisation %v but got %v (%v)", tc.desc, tc.expected, u, ok)
+		}
+	}
+
+	unsized := newNode("node1", "50")
+	if _, ok := cache.utilisation(&unsized, &pod); ok {
+		t.Errorf("Expected no utilisation for a node without allocatable resources")
+	}
+}
+
+// TestHeadroomRanking tests that a cool but nearly full node loses to a
+// slightly warmer node with headroom once utilisation is weighed in.
+func TestHeadroomRanking(t *testing.T) {
+	defer func(p *podCache) { pods = p }(pods)
+	pods = newPodCache()
+	pods.replace([]k8sApi.Pod{
+		newBoundPod("a", "node1", "3500m"),
+		newBoundPod("b", "node2", "500m"),
+	})
+	list := newNodeList(
+		newSizedNode("node1", "50", "4", "8Gi"),
+		newSizedNode("node2", "55", "4", "8Gi"),
+		newSizedNode("node3", "90", "4", "8Gi"),
+	)
+	pod := newPod("new", nil, "250m")
+
+	testCases := map[string]struct {
+		weight   float64
+		expected string
+	}{
+		"heat only":       {0, "node1"},
+		"small weight":    {0.05, "node1"},
+		"balanced weight": {0.5, "node2"},
+		"headroom only":   {1, "node3"},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Headroom.Weight = tc.weight
+		nodes, _, err := filterNodes(withHeadroom(c, &pod), readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		if nodes[0].Name != tc.expected {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, nodes[0].Name)
+		}
+	}
+
+	c := defaultConfig()
+	c.Headroom.Weight = 0.5
+	priorities, err := prioritizeNodes(withHeadroom(c, &pod), readCandidates(c, list.Items))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if priorities[1].Score != maxPriority || priorities[0].Score >= priorities[1].Score {
+		t.Errorf("Expected node2 to score highest but got %v", priorities)
+	}
+}
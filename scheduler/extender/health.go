@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// version is the version of the extender, it can be overridden at build time
+// using -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// heatStatus records which heat data the extender saw in the most recent
+// request from the scheduler.
+type heatStatus struct {
+	mu          sync.Mutex // guards the fields below
+	lastRequest time.Time  // time of the most recent request
+	lastUsable  time.Time  // time of the most recent request with usable heat data
+	nodes       int        // number of nodes in the most recent request
+	usable      int        // number of nodes with valid heat in the most recent request
+	source      string     // name of the heat source in the most recent request
+	draining    bool       // whether the extender is shutting down
+}
+
+// status is the heat status shared by all handlers.
+var status = &heatStatus{}
+
+// record updates the status with the nodes received in a request. Requests
+// without nodes say nothing about heat data and are ignored.
+func (s *heatStatus) record(c *config, nodes []candidate) {
+	if len(nodes) == 0 {
+		return
+	}
+	usable := 0
+	for i := range nodes {
+		if nodes[i].err == nil {
+			usable++
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.lastRequest = now
+	s.nodes = len(nodes)
+	s.usable = usable
+	s.source = c.source.Name()
+	if usable > 0 {
+		s.lastUsable = now
+	}
+}
+
+// ready returns whether the extender is able to serve the scheduler and a
+// message explaining why. Readiness follows the state of the extender itself,
+// its heat source and node cache, and never the requests it received: a pod
+// that is not ready gets no requests, so it could never become ready again.
+// The heat seen in the last request is only reported in the message.
+func (s *heatStatus) ready(c *config) (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return false, "shutting down"
+	}
+	if err := sourceReady(c.source); err != nil {
+		return false, err.Error()
+	}
+	if c.watchesNodes() && !cachedNodes.hasSynced() {
+		return false, errNodeCacheNotSynced.Error()
+	}
+	if s.lastRequest.IsZero() {
+		return true, "no requests received yet"
+	}
+	return true, fmt.Sprintf("%v of %v nodes in the last request had valid heat in %v", s.usable, s.nodes, s.source)
+}
+
+// drain marks the extender as shutting down, so it is no longer ready and
+// the scheduler stops being routed to it.
+func (s *heatStatus) drain() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.draining = true
+}
+
+// healthz reports that the extender is alive.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz reports whether the extender is able to serve the scheduler.
+func readyz(w http.ResponseWriter, r *http.Request) {
+	ready, msg := status.ready(currentConfig())
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, msg)
+}
+
+// versionHandler reports the version of the extender.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"version":   version,
+		"goVersion": runtime.Version(),
+	})
+}
+
+// allowMethods wraps a handler so it rejects requests whose method is not
+// one of methods with status 405.
+func allowMethods(h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				h(w, r)
+				return
+			}
+		}
+		for _, m := range methods {
+			w.Header().Add("Allow", m)
+		}
+		http.Error(w, fmt.Sprintf("method %v not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
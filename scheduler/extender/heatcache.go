@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// maxCachedNodes bounds the number of nodes a heatCache holds. The cache is
+// emptied when it is full, which only happens when nodes keep being replaced.
+const maxCachedNodes = 10000
+
+// cachedReading is the result of reading a node at a resource version.
+type cachedReading struct {
+	version string
+	reading heatReading
+	err     error
+}
+
+// cachedSource wraps a heat source that parses node objects and reuses the
+// parsed reading of a node until its resource version changes. The API server
+// changes the resource version on every update of a node, including updates of
+// its labels and annotations, so large clusters only parse the nodes whose
+// heat was written since the previous request.
+type cachedSource struct {
+	HeatSource
+	cache *heatCache
+}
+
+// heatCache holds the readings of a cachedSource.
+type heatCache struct {
+	mu      sync.RWMutex             // guards entries
+	entries map[string]cachedReading // readings by node name
+}
+
+// newCachedSource returns an empty cache in front of s.
+func newCachedSource(s HeatSource) cachedSource {
+	return cachedSource{HeatSource: s, cache: &heatCache{entries: make(map[string]cachedReading)}}
+}
+
+// Heat returns the cached reading of a node, or reads the node from the
+// wrapped source when its resource version changed. Nodes without a resource
+// version are always read.
+func (s cachedSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	version := node.ResourceVersion
+	if version == "" {
+		return s.HeatSource.Heat(node)
+	}
+	if e, ok := s.cache.get(node.Name); ok && e.version == version {
+		return e.reading, e.err
+	}
+	r, err := s.HeatSource.Heat(node)
+	s.cache.put(node.Name, cachedReading{version: version, reading: r, err: err})
+	return r, err
+}
+
+// get returns the cached reading of a node.
+func (h *heatCache) get(node string) (cachedReading, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.entries[node]
+	return e, ok
+}
+
+// put caches the reading of a node, emptying the cache first when it is full.
+func (h *heatCache) put(node string, e cachedReading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) >= maxCachedNodes {
+		h.entries = make(map[string]cachedReading)
+	}
+	h.entries[node] = e
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// countingSource counts how often nodes are read from the wrapped source.
+type countingSource struct {
+	HeatSource
+	reads *int
+}
+
+func (s countingSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	*s.reads++
+	return s.HeatSource.Heat(node)
+}
+
+// TestCachedSource tests that a node is parsed again only when its resource
+// version changes.
+func TestCachedSource(t *testing.T) {
+	reads := 0
+	s := newCachedSource(countingSource{labelSource{key: defaultLabelKey}, &reads})
+
+	testCases := []struct {
+		desc     string
+		version  string
+		joules   string
+		expected float64
+		reads    int
+	}{
+		{"first read", "1", "50", 50, 1},
+		{"same version", "1", "50", 50, 1},
+		{"new version", "2", "60", 60, 2},
+		{"new version without heat", "3", "", 0, 3},
+		{"same version without heat", "3", "", 0, 3},
+		{"no version", "", "70", 70, 4},
+		{"no version again", "", "70", 70, 5},
+	}
+
+	for _, tc := range testCases {
+		node := newNode("node1", tc.joules)
+		node.ResourceVersion = tc.version
+		r, err := s.Heat(&node)
+		if tc.joules == "" && err != errNoHeat {
+			t.Errorf("Test case %v: expected %v but got %v", tc.desc, errNoHeat, err)
+		}
+		if r.Joules != tc.expected {
+			t.Errorf("Test case %v: expected %v joules but got %v", tc.desc, tc.expected, r.Joules)
+		}
+		if reads != tc.reads {
+			t.Errorf("Test case %v: expected %v reads but got %v", tc.desc, tc.reads, reads)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	heatSourceLabel      = "label"      // read the joules label written by the monitor
+	heatSourceAnnotation = "annotation" // read a joules annotation
+	heatSourceHTTP       = "http"       // poll a heat service
+
+	// defaultHeatAnnotationKey is the key of the node annotation read by the
+	// annotation source.
+	defaultHeatAnnotationKey = "heat-scheduling/joules"
+)
+
+// errNoHeat is returned by a HeatSource that has no value for a node.
+var errNoHeat = errors.New("no heat value")
+
+// heatReading is the heat of a node reported by a HeatSource.
+type heatReading struct {
+	Joules  float64
+	Version string    // changes every time the source publishes a new value for the node
+	Updated time.Time // time the value was measured, zero if the source does not know
+	Stale   bool      // the value is older than the max age and was down-weighted
+}
+
+// HeatSource tells the extender how warm a node is.
+type HeatSource interface {
+	// Name describes the source in logs and error messages.
+	Name() string
+	// Heat returns the reading of a node, errNoHeat if the source has no
+	// value for the node or another error if the value is invalid.
+	Heat(node *k8sApi.Node) (heatReading, error)
+}
+
+// heatSourceConfig selects where the extender reads the heat of nodes.
+type heatSourceConfig struct {
+	Kind          string   `json:"kind"`          // label, annotation or http
+	AnnotationKey string   `json:"annotationKey"` // annotation read by the annotation source
+	URL           string   `json:"url"`           // heat service polled by the http source
+	Interval      duration `json:"interval"`      // time between two polls of the heat service
+	Timeout       duration `json:"timeout"`       // time a poll of the heat service may take
+}
+
+// validate returns an error describing the first invalid setting of s.
+func (s *heatSourceConfig) validate() error {
+	switch s.Kind {
+	case heatSourceLabel:
+	case heatSourceAnnotation:
+		if s.AnnotationKey == "" {
+			return fmt.Errorf("annotation key must not be empty")
+		}
+	case heatSourceHTTP:
+		u, err := url.Parse(s.URL)
+		if err != nil || !u.IsAbs() {
+			return fmt.Errorf("url must be an absolute URL, got %q", s.URL)
+		}
+		if s.Interval.Duration <= 0 {
+			return fmt.Errorf("interval must be positive, got %v", s.Interval)
+		}
+		if s.Timeout.Duration <= 0 {
+			return fmt.Errorf("timeout must be positive, got %v", s.Timeout)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	return nil
+}
+
+// newHeatSource returns the heat source described by c, wrapped by the
+// staleness policy when it has a max age. Sources that parse node objects
+// are cached by resource version. The http source only starts
+// polling once the config is made active by setConfig.
+func newHeatSource(c *config) HeatSource {
+	var s HeatSource
+	switch c.Source.Kind {
+	case heatSourceAnnotation:
+		s = newCachedSource(annotationSource{key: c.Source.AnnotationKey, updatedAtKey: c.Staleness.UpdatedAtKey})
+	case heatSourceHTTP:
+		s = newHTTPSource(c.Source.URL, c.Source.Interval.Duration, c.Source.Timeout.Duration)
+	default:
+		s = newCachedSource(labelSource{key: c.LabelKey, updatedAtKey: c.Staleness.UpdatedAtKey})
+	}
+	if c.Staleness.MaxAge.Duration > 0 {
+		s = staleSource{HeatSource: s, policy: c.Staleness, now: time.Now}
+	}
+	return s
+}
+
+// parseJoules parses a joules value published as a string at full
+// precision, so nodes of nearly equal heat do not compare as equal.
+func parseJoules(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+// labelSource reads the joules label the monitor writes on every node and
+// the label recording when it was written.
+type labelSource struct {
+	key          string
+	updatedAtKey string
+}
+
+// Name describes the source.
+func (s labelSource) Name() string {
+	return fmt.Sprintf("label %v", s.key)
+}
+
+// Heat parses the joules label of a node.
+func (s labelSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	return readString(node.Labels, s.key, s.updatedAtKey)
+}
+
+// annotationSource reads a joules annotation, which is not limited to the
+// characters allowed in a label value, and the annotation recording when it
+// was written.
+type annotationSource struct {
+	key          string
+	updatedAtKey string
+}
+
+// Name describes the source.
+func (s annotationSource) Name() string {
+	return fmt.Sprintf("annotation %v", s.key)
+}
+
+// Heat parses the joules annotation of a node.
+func (s annotationSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	return readString(node.Annotations, s.key, s.updatedAtKey)
+}
+
+// readString parses the joules stored under key in m, the raw value is the
+// version of the reading. The reading has no time when updatedAtKey is
+// missing or invalid.
+func readString(m map[string]string, key, updatedAtKey string) (heatReading, error) {
+	s, ok := m[key]
+	if !ok {
+		return heatReading{}, errNoHeat
+	}
+	joules, err := parseJoules(s)
+	if err != nil {
+		return heatReading{}, fmt.Errorf("%q is not a number", s)
+	}
+	r := heatReading{Joules: joules, Version: s}
+	if updated, err := parseUpdatedAt(m[updatedAtKey]); err == nil {
+		r.Updated = updated
+	}
+	return r, nil
+}
+
+// heatReport is the body served by a heat service, for example
+// {"nodes": [{"name": "node1", "joules": 1234.5, "timestamp": "2016-06-01T12:00:00Z"}]}.
+type heatReport struct {
+	Nodes []struct {
+		Name      string    `json:"name"`
+		Joules    float64   `json:"joules"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"nodes"`
+}
+
+// httpSource polls a heat service and caches the most recent reading of
+// every node it reported. A failed poll keeps the cached readings.
+type httpSource struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	now      func() time.Time
+
+	mu       sync.RWMutex // guards readings, polled and pollErr
+	readings map[string]heatReading
+	polled   bool  // whether the heat service was polled at least once
+	pollErr  error // error of the most recent poll, nil if it succeeded
+	done     chan struct{}
+}
+
+// newHTTPSource returns a source polling url every interval.
+func newHTTPSource(url string, interval, timeout time.Duration) *httpSource {
+	return &httpSource{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+		now:      time.Now,
+		readings: make(map[string]heatReading),
+		done:     make(chan struct{}),
+	}
+}
+
+// Name describes the source.
+func (s *httpSource) Name() string {
+	return fmt.Sprintf("heat service %v", s.url)
+}
+
+// Heat returns the cached reading of a node.
+func (s *httpSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.readings[node.Name]
+	if !ok {
+		return heatReading{}, errNoHeat
+	}
+	return r, nil
+}
+
+// start polls the heat service right away and then every interval until
+// stop is called.
+func (s *httpSource) start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			if err := s.poll(); err != nil {
+				errorf("Could not poll %v, keeping the cached heat: %v", s.Name(), err)
+			}
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stop stops polling.
+func (s *httpSource) stop() {
+	close(s.done)
+}
+
+// poll fetches the heat of all nodes from the heat service and updates the
+// cache. Readings without a timestamp are stamped with the time of the poll
+// and versioned by their joules alone, so an unchanged reading keeps its
+// version across polls. The outcome is kept for ready.
+func (s *httpSource) poll() (err error) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.polled = true
+		s.pollErr = err
+	}()
+	res, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("heat service answered with status %v", res.Status)
+	}
+	report := &heatReport{}
+	if err := json.NewDecoder(res.Body).Decode(report); err != nil {
+		return fmt.Errorf("heat service answered with an invalid report: %v", err)
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range report.Nodes {
+		updated, version := n.Timestamp, fmt.Sprintf("%v@%v", n.Joules, n.Timestamp.UnixNano())
+		if updated.IsZero() {
+			updated, version = now, fmt.Sprint(n.Joules)
+		}
+		s.readings[n.Name] = heatReading{
+			Joules:  n.Joules,
+			Version: version,
+			Updated: updated,
+		}
+	}
+	debugf("Polled the heat of %v nodes from %v", len(report.Nodes), s.url)
+	return nil
+}
+
+// ready returns an error when the heat service was not polled yet or its
+// most recent poll failed.
+func (s *httpSource) ready() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.polled {
+		return fmt.Errorf("%v was not polled yet", s.Name())
+	}
+	if s.pollErr != nil {
+		return fmt.Errorf("the last poll of %v failed: %v", s.Name(), s.pollErr)
+	}
+	return nil
+}
+
+// sourceReady returns an error when s, or the source it wraps, can not
+// serve heat. Sources reading node objects are always ready.
+func sourceReady(s HeatSource) error {
+	switch w := s.(type) {
+	case *httpSource:
+		return w.ready()
+	case staleSource:
+		return sourceReady(w.HeatSource)
+	case cachedSource:
+		return sourceReady(w.HeatSource)
+	}
+	return nil
+}
+
+// sameAs returns whether o is an http source with the same settings as s.
+func (s *httpSource) sameAs(o HeatSource) bool {
+	h, ok := o.(*httpSource)
+	return ok && h.url == s.url && h.interval == s.interval && h.client.Timeout == s.client.Timeout
+}
+
+// switchSource stops old and starts new when the active heat source changes.
+// An http source with unchanged settings is kept so its cache survives a
+// reload, switchSource returns the source that ends up active.
+func switchSource(old, new HeatSource) HeatSource {
+	// the staleness policy may change while the wrapped source is kept.
+	if s, ok := new.(staleSource); ok {
+		s.HeatSource = switchSource(old, s.HeatSource)
+		return s
+	}
+	if s, ok := old.(staleSource); ok {
+		return switchSource(s.HeatSource, new)
+	}
+	if h, ok := old.(*httpSource); ok && h.sameAs(new) {
+		return old
+	}
+	if old == new {
+		return new
+	}
+	if h, ok := old.(*httpSource); ok {
+		h.stop()
+	}
+	if h, ok := new.(*httpSource); ok {
+		h.start()
+	}
+	return new
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// TestStringSources tests that the label and annotation sources parse the
+// joules of a node.
+func TestStringSources(t *testing.T) {
+	annotated := newNode("node1", "")
+	annotated.Annotations = map[string]string{defaultHeatAnnotationKey: "12.5"}
+	broken := newNode("node2", "")
+	broken.Annotations = map[string]string{defaultHeatAnnotationKey: "warm"}
+
+	testCases := map[string]struct {
+		source   HeatSource
+		node     k8sApi.Node
+		expected float64
+		err      bool
+	}{
+		"label":               {labelSource{key: defaultLabelKey}, newNode("node1", "50.5"), 50.5, false},
+		"missing label":       {labelSource{key: defaultLabelKey}, newNode("node1", ""), 0, true},
+		"unparseable label":   {labelSource{key: defaultLabelKey}, newNode("node1", "illigal"), 0, true},
+		"annotation":          {annotationSource{key: defaultHeatAnnotationKey}, annotated, 12.5, false},
+		"missing annotation":  {annotationSource{key: defaultHeatAnnotationKey}, newNode("node1", "50.5"), 0, true},
+		"invalid annotation":  {annotationSource{key: defaultHeatAnnotationKey}, broken, 0, true},
+		"label of annotation": {labelSource{key: defaultLabelKey}, annotated, 0, true},
+	}
+
+	for desc, tc := range testCases {
+		r, err := tc.source.Heat(&tc.node)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Test case %v: expected an error but got %v", desc, r.Joules)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		if r.Joules != tc.expected {
+			t.Errorf("Test case %v: expected %v joules but got %v", desc, tc.expected, r.Joules)
+		}
+	}
+}
+
+// TestHTTPSource tests that the http source caches the polled readings and
+// keeps them when a poll fails.
+func TestHTTPSource(t *testing.T) {
+	body, code := "", http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	s := newHTTPSource(srv.URL, time.Minute, time.Second)
+	now := time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = fakeClock(&now)
+	node1, node2 := newNode("node1", ""), newNode("node2", "")
+
+	if _, err := s.Heat(&node1); err != errNoHeat {
+		t.Errorf("Expected no heat before the first poll but got %v", err)
+	}
+
+	body = `{"nodes": [{"name": "node1", "joules": 1234.567, "timestamp": "2016-06-01T11:59:00Z"}, {"name": "node2", "joules": 10}]}`
+	if err := s.poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r, err := s.Heat(&node1)
+	if err != nil || r.Joules != 1234.567 || !r.Updated.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Expected 1234.567 joules measured at 11:59 but got %+v (%v)", r, err)
+	}
+	r, err = s.Heat(&node2)
+	if err != nil || !r.Updated.Equal(now) {
+		t.Errorf("Expected a reading without timestamp to be stamped with the poll time but got %+v (%v)", r, err)
+	}
+	version := r.Version
+
+	// an unchanged value without timestamp keeps the version
+	now = now.Add(time.Minute)
+	if err := s.poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r, _ := s.Heat(&node2); r.Version != version || !r.Updated.Equal(now) {
+		t.Errorf("Expected version %v stamped with the new poll time but got %+v", version, r)
+	}
+
+	// a new value changes the version
+	body = `{"nodes": [{"name": "node2", "joules": 20}]}`
+	now = now.Add(time.Minute)
+	if err := s.poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r, _ := s.Heat(&node2); r.Joules != 20 || r.Version == version {
+		t.Errorf("Expected a new version with 20 joules but got %+v", r)
+	}
+	if _, err := s.Heat(&node1); err != nil {
+		t.Errorf("Expected node1 to stay cached when it is not reported: %v", err)
+	}
+
+	// failed polls keep the cache
+	for desc, tc := range map[string]struct {
+		body string
+		code int
+	}{
+		"bad status":     {`{"nodes": []}`, http.StatusInternalServerError},
+		"invalid report": {`{"nodes": `, http.StatusOK},
+	} {
+		body, code = tc.body, tc.code
+		if err := s.poll(); err == nil {
+			t.Errorf("Test case %v: expected an error", desc)
+		}
+		if r, err := s.Heat(&node2); err != nil || r.Joules != 20 {
+			t.Errorf("Test case %v: expected the cached reading but got %+v (%v)", desc, r, err)
+		}
+	}
+}
+
+// TestSwitchSource tests that the http source is started when it becomes
+// active and kept across a reload with the same settings.
+func TestSwitchSource(t *testing.T) {
+	polled := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"nodes": [{"name": "node1", "joules": 5}]}`)
+		polled <- struct{}{}
+	}))
+	defer srv.Close()
+
+	label := labelSource{key: defaultLabelKey}
+	first := newHTTPSource(srv.URL, time.Hour, time.Second)
+	if s := switchSource(label, first); s != first {
+		t.Fatalf("Expected the http source to become active")
+	}
+	defer first.stop()
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the http source to poll when started")
+	}
+
+	if s := switchSource(first, newHTTPSource(srv.URL, time.Hour, time.Second)); s != first {
+		t.Errorf("Expected an http source with the same settings to be kept")
+	}
+	if s := switchSource(label, label); s != label {
+		t.Errorf("Expected the label source to be kept")
+	}
+}
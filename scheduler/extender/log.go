@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelError
+)
+
+// logLevels maps the names of log levels used in the config to levels.
+var logLevels = map[string]int32{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"error": levelError,
+}
+
+// logLevel is the lowest level that is printed, it is read and written
+// atomically so it can change on reload.
+var logLevel = levelInfo
+
+// setLogLevel sets the lowest level that is printed.
+func setLogLevel(name string) error {
+	level, ok := logLevels[name]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	atomic.StoreInt32(&logLevel, level)
+	return nil
+}
+
+// logf prints a line if level is at or above the current log level.
+func logf(level int32, format string, args ...interface{}) {
+	if level < atomic.LoadInt32(&logLevel) {
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// debugf prints a line that is only useful when debugging.
+func debugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+
+// infof prints a line about normal operation.
+func infof(format string, args ...interface{}) { logf(levelInfo, format, args...) }
+
+// errorf prints a line about something that went wrong.
+func errorf(format string, args ...interface{}) { logf(levelError, format, args...) }
@@ -2,25 +2,99 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
-)
+	"os"
+	"os/signal"
+	"syscall"
 
-const (
-	// port is the port on which the scheduler listens for HTTP traffic.
-	port = "8100"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
-	fmt.Printf("Starts listening\n")
+	c, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := setConfig(c); err != nil {
+		fmt.Printf("Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go reloadOnSignal(hup, os.Args[1:])
+
+	// watch the pods bound to nodes when heat is blended with headroom.
+	if c.Headroom.Weight > 0 {
+		w, err := newPodWatcher(c.Headroom.APIServer, pods)
+		if err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(2)
+		}
+		go w.run(nil)
+	}
+
+	// watch the nodes when the scheduler may send node names only or the
+	// power budget needs the heat of every node.
+	if c.watchesNodes() {
+		w, err := newNodeWatcher(c.NodeCache.APIServer, cachedNodes)
+		if err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(2)
+		}
+		go w.run(nil)
+	}
+
+	// listen before anything else so a taken port fails the process.
+	ln, err := net.Listen("tcp", c.Address)
+	if err != nil {
+		fmt.Printf("Could not listen on %v: %v\n", c.Address, err)
+		os.Exit(1)
+	}
+	infof("Starts listening on %v", c.Address)
 
 	// start server
-	svr := &http.Server{
-		Addr: ":" + port,
+	svr := newServer(c, newMux())
+	if c.TLS.CertFile != "" {
+		reloader, err := newCertReloader(c.TLS)
+		if err != nil {
+			fmt.Printf("Invalid configuration: %v\n", err)
+			os.Exit(2)
+		}
+		svr.TLSConfig = reloader.tlsConfig()
 	}
-	svr.Handler = http.HandlerFunc(handler)
-	svr.ListenAndServe()
 
-	// make sure we live forever.
-	ch := make(chan bool)
-	<-ch
+	// serve until SIGTERM, then drain the requests in flight.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	if err := serve(svr, ln, stop, c.Server.ShutdownTimeout.Duration); err != nil {
+		fmt.Printf("Stopped serving: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// apiVersion is the apiVersion of the extender in the scheduler policy. The
+// scheduler posts its verbs to urlPrefix/apiVersion/verb.
+const apiVersion = "v1"
+
+// newMux returns a ServeMux that routes the scheduler verbs, the explain
+// endpoint, the health endpoints, the metrics and the decision audit log.
+// The scheduler verbs and explain are served both below /v1/, where the
+// scheduler posts them, and at the root. Only the scheduler verbs and explain
+// are subject to the request limits, so probes and scrapes are never shed.
+// Requests to any other path are answered with status 404.
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, prefix := range []string{"", "/" + apiVersion} {
+		mux.HandleFunc(prefix+"/filter", allowMethods(requireClientCert(limitRequest(verbFilter, handler)), "POST"))
+		mux.HandleFunc(prefix+"/prioritize", allowMethods(requireClientCert(limitRequest(verbPrioritize, prioritize)), "POST"))
+		mux.HandleFunc(prefix+"/explain", allowMethods(requireClientCert(limitRequest(verbExplain, explain)), "POST"))
+	}
+	mux.HandleFunc("/healthz", allowMethods(healthz, "GET", "HEAD"))
+	mux.HandleFunc("/readyz", allowMethods(readyz, "GET", "HEAD"))
+	mux.HandleFunc("/version", allowMethods(versionHandler, "GET", "HEAD"))
+	mux.Handle("/metrics", prometheus.Handler())
+	mux.HandleFunc("/decisions", allowMethods(decisionsHandler, "GET", "HEAD"))
+	return mux
 }
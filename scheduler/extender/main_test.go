@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// TestMuxRoutes tests that requests are routed by path and method.
+func TestMuxRoutes(t *testing.T) {
+	defer func(s *heatStatus) { status = s }(status)
+	status = &heatStatus{}
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{
+		Nodes: newNodeList(newNode("node1", "50.5")),
+	})
+	if err != nil {
+		t.Errorf("Error when trying to convert args to bytes: %v", err)
+		return
+	}
+
+	testCases := map[string]struct {
+		method   string
+		path     string
+		body     []byte
+		expected int
+	}{
+		"filter":              {"POST", "/filter", b, http.StatusOK},
+		"prioritize":          {"POST", "/prioritize", b, http.StatusOK},
+		"explain":             {"POST", "/explain", b, http.StatusOK},
+		"v1 filter":           {"POST", "/v1/filter", b, http.StatusOK},
+		"v1 prioritize":       {"POST", "/v1/prioritize", b, http.StatusOK},
+		"v1 explain":          {"POST", "/v1/explain", b, http.StatusOK},
+		"get v1 filter":       {"GET", "/v1/filter", nil, http.StatusMethodNotAllowed},
+		"other version":       {"POST", "/v2/filter", b, http.StatusNotFound},
+		"get explain":         {"GET", "/explain", nil, http.StatusMethodNotAllowed},
+		"healthz":             {"GET", "/healthz", nil, http.StatusOK},
+		"readyz":              {"GET", "/readyz", nil, http.StatusOK},
+		"version":             {"GET", "/version", nil, http.StatusOK},
+		"metrics":             {"GET", "/metrics", nil, http.StatusOK},
+		"decisions":           {"GET", "/decisions", nil, http.StatusOK},
+		"get filter":          {"GET", "/filter", nil, http.StatusMethodNotAllowed},
+		"post healthz":        {"POST", "/healthz", nil, http.StatusMethodNotAllowed},
+		"unknown path":        {"POST", "/bind", b, http.StatusNotFound},
+		"root":                {"GET", "/", nil, http.StatusNotFound},
+		"filter with subpath": {"POST", "/filter/x", b, http.StatusNotFound},
+	}
+
+	for desc, tc := range testCases {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, bytes.NewBuffer(tc.body))
+		if err != nil {
+			t.Errorf("Test case %v: error creating request: %v", desc, err)
+			continue
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v: error making request: %v", desc, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.expected {
+			t.Errorf("Test case %v: expected status %v but got %v", desc, tc.expected, res.StatusCode)
+		}
+	}
+}
+
+// TestReady tests that readiness follows the heat source and the node cache
+// and not the heat seen in requests, so a pod that is not ready can recover
+// without being sent requests.
+func TestReady(t *testing.T) {
+	defer func(n *nodeCache) { cachedNodes = n }(cachedNodes)
+	cachedNodes = newNodeCache()
+
+	s := &heatStatus{}
+	c := defaultConfig()
+	if ready, msg := s.ready(c); !ready {
+		t.Errorf("Expected to be ready before the first request: %v", msg)
+	}
+
+	list := newNodeList(newNode("node1", ""), newNode("node2", "illigal"))
+	s.record(c, readCandidates(c, list.Items))
+	if ready, msg := s.ready(c); !ready {
+		t.Errorf("Expected to stay ready without usable heat data in a request: %v", msg)
+	}
+	if _, msg := s.ready(c); !strings.Contains(msg, "0 of 2 nodes") {
+		t.Errorf("Expected the message to report the heat of the last request but got %q", msg)
+	}
+
+	c.Budget.MaxWatts = 1000
+	if ready, _ := s.ready(c); ready {
+		t.Errorf("Expected not to be ready with a power budget before the node cache is synced")
+	}
+	c.Budget.MaxWatts = 0
+	c.NodeCache.Enabled = true
+	if ready, _ := s.ready(c); ready {
+		t.Errorf("Expected not to be ready before the node cache is synced")
+	}
+	cachedNodes.replace(nil)
+	if ready, msg := s.ready(c); !ready {
+		t.Errorf("Expected to be ready once the node cache is synced: %v", msg)
+	}
+
+	code := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte(`{"nodes": []}`))
+	}))
+	defer srv.Close()
+	h := newHTTPSource(srv.URL, time.Minute, time.Second)
+	c.source = staleSource{HeatSource: h, policy: c.Staleness, now: time.Now}
+	if ready, _ := s.ready(c); ready {
+		t.Errorf("Expected not to be ready before the heat service was polled")
+	}
+	h.poll()
+	if ready, msg := s.ready(c); !ready {
+		t.Errorf("Expected to be ready after a successful poll: %v", msg)
+	}
+	code = http.StatusInternalServerError
+	h.poll()
+	if ready, _ := s.ready(c); ready {
+		t.Errorf("Expected not to be ready after a failed poll")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "heat_scheduler_extender"
+
+	verbFilter     = "filter"
+	verbPrioritize = "prioritize"
+	verbExplain    = "explain"
+
+	outcomeSuccess    = "success"     // the request was served
+	outcomeNoNodes    = "no_nodes"    // the request was served but no node passed
+	outcomeBadRequest = "bad_request" // the request could not be decoded
+	outcomeError      = "error"       // the request could not be served
+	outcomeShed       = "shed"        // the request was rejected because too many requests were in flight
+
+	skipMissing     = "missing"     // the heat source has no value for the node
+	skipUnparseable = "unparseable" // the heat source has a value for the node that is not a number
+	skipStale       = "stale"       // the heat of the node is older than the max age
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of requests from the scheduler by verb and outcome.",
+	}, []string{"verb", "outcome"})
+
+	decisionSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "decision_duration_seconds",
+		Help:      "Time taken to answer a request from the scheduler by verb.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"verb"})
+
+	nodeChosenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_chosen_total",
+		Help:      "Number of times a node passed the filter.",
+	}, []string{"node"})
+
+	candidateNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "candidate_nodes",
+		Help:      "Number of candidate nodes in the most recent request by verb.",
+	}, []string{"verb"})
+
+	nodesSkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "nodes_skipped_total",
+		Help:      "Number of candidate nodes without usable heat by reason.",
+	}, []string{"reason"})
+
+	staleNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "stale_nodes",
+		Help:      "Number of candidate nodes with heat older than the max age in the most recent request by verb.",
+	}, []string{"verb"})
+
+	criticalNodes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "critical_nodes",
+		Help:      "Number of candidate nodes above the critical level in the most recent filter request.",
+	})
+
+	clusterWatts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "estimated_cluster_watts",
+		Help:      "Estimated watts of the cluster checked against the power budget in the most recent filter request.",
+	})
+
+	budgetRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "budget_rejections_total",
+		Help:      "Number of pods rejected because they would exceed the power budget by budget, soft or hard.",
+	}, []string{"budget"})
+
+	exemptTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "exempt_requests_total",
+		Help:      "Number of requests for pods exempt from heat filtering by verb and action.",
+	}, []string{"verb", "action"})
+
+	missingHeatTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "missing_heat_nodes_total",
+		Help:      "Number of candidate nodes without heat handled by the missing heat policy by policy and action.",
+	}, []string{"policy", "action"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal)
+	prometheus.MustRegister(decisionSeconds)
+	prometheus.MustRegister(nodeChosenTotal)
+	prometheus.MustRegister(candidateNodes)
+	prometheus.MustRegister(nodesSkippedTotal)
+	prometheus.MustRegister(missingHeatTotal)
+	prometheus.MustRegister(staleNodes)
+	prometheus.MustRegister(exemptTotal)
+	prometheus.MustRegister(criticalNodes)
+	prometheus.MustRegister(clusterWatts)
+	prometheus.MustRegister(budgetRejectedTotal)
+}
+
+// observeRequest records the outcome and duration of a request.
+func observeRequest(verb, outcome string, start time.Time) {
+	requestsTotal.WithLabelValues(verb, outcome).Inc()
+	decisionSeconds.WithLabelValues(verb).Observe(time.Since(start).Seconds())
+}
+
+// observeNodes records the number of candidate nodes and stale nodes in a
+// request and counts the nodes whose heat is missing, stale or can not be
+// parsed.
+func observeNodes(c *config, verb string, nodes []candidate) {
+	candidateNodes.WithLabelValues(verb).Set(float64(len(nodes)))
+	stale := 0
+	for _, node := range nodes {
+		switch err := node.err; {
+		case err == errNoHeat:
+			nodesSkippedTotal.WithLabelValues(skipMissing).Inc()
+		case err == errStale:
+			nodesSkippedTotal.WithLabelValues(skipStale).Inc()
+			stale++
+		case err != nil:
+			nodesSkippedTotal.WithLabelValues(skipUnparseable).Inc()
+		case node.reading.Stale:
+			stale++
+		}
+	}
+	staleNodes.WithLabelValues(verb).Set(float64(stale))
+	if stale > 0 {
+		errorf("%v of %v nodes have heat older than %v, is the monitor running?", stale, len(nodes), c.Staleness.MaxAge)
+	}
+}
+
+// observeChosen counts the nodes that passed the filter.
+func observeChosen(nodes []candidate) {
+	for _, node := range nodes {
+		nodeChosenTotal.WithLabelValues(node.Name).Inc()
+	}
+}
+
+// observeMissing counts the nodes without heat handled by a missing heat
+// policy.
+func observeMissing(policy, action string, nodes int) {
+	missingHeatTotal.WithLabelValues(policy, action).Add(float64(nodes))
+}
+
+// observeExempt counts a request for an exempt pod, x is nil if the pod is
+// not exempt.
+func observeExempt(verb string, x *exemption) {
+	if x != nil {
+		exemptTotal.WithLabelValues(verb, x.Action).Inc()
+	}
+}
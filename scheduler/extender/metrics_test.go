@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue returns the current value of a counter.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Error reading counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// gaugeValue returns the current value of a gauge.
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	m := &dto.Metric{}
+	if err := g.Write(m); err != nil {
+		t.Fatalf("Error reading gauge: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+// TestFilterMetrics tests that a filter request updates the metrics.
+func TestFilterMetrics(t *testing.T) {
+	defer setConfig(currentConfig())
+	setConfig(defaultConfig())
+
+	success := requestsTotal.WithLabelValues(verbFilter, outcomeSuccess)
+	badRequest := requestsTotal.WithLabelValues(verbFilter, outcomeBadRequest)
+	chosen := nodeChosenTotal.WithLabelValues("metrics-node1")
+	missing := nodesSkippedTotal.WithLabelValues(skipMissing)
+	unparseable := nodesSkippedTotal.WithLabelValues(skipUnparseable)
+	before := []float64{
+		counterValue(t, success),
+		counterValue(t, badRequest),
+		counterValue(t, chosen),
+		counterValue(t, missing),
+		counterValue(t, unparseable),
+	}
+
+	b := marshalArgs(t, newNodeList(
+		newNode("metrics-node1", "50.5"),
+		newNode("metrics-node2", ""),
+		newNode("metrics-node3", "illigal"),
+	))
+	req, _ := http.NewRequest("POST", "/filter", bytes.NewBuffer(b))
+	handler(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("POST", "/filter", strings.NewReader("not json"))
+	handler(httptest.NewRecorder(), req)
+
+	after := []float64{
+		counterValue(t, success),
+		counterValue(t, badRequest),
+		counterValue(t, chosen),
+		counterValue(t, missing),
+		counterValue(t, unparseable),
+	}
+	names := []string{"success", "bad request", "chosen", "missing", "unparseable"}
+	for i := range names {
+		if after[i]-before[i] != 1 {
+			t.Errorf("Expected %v to increase by 1 but it increased by %v", names[i], after[i]-before[i])
+		}
+	}
+	if n := gaugeValue(t, candidateNodes.WithLabelValues(verbFilter)); n != 3 {
+		t.Errorf("Expected 3 candidate nodes but got %v", n)
+	}
+}
+
+// TestMetricsEndpoint tests that the metrics are served.
+func TestMetricsEndpoint(t *testing.T) {
+	srv := httptest.NewServer(newMux())
+	defer srv.Close()
+
+	requestsTotal.WithLabelValues(verbPrioritize, outcomeSuccess).Inc()
+	res, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Errorf("Error when making get request: %v", err)
+		return
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Errorf("Error reading metrics: %v", err)
+		return
+	}
+	if !strings.Contains(string(body), metricsNamespace+"_requests_total") {
+		t.Errorf("Expected %v_requests_total in metrics", metricsNamespace)
+	}
+}
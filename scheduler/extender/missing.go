@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// missingOpen ranks nodes without heat behind every other node and lets
+	// all nodes pass when none of them has heat, so the kubernetes scheduler
+	// decides. The threshold filter modes only pass nodes known to be below
+	// their limit, so there open differs from closed only when no node has
+	// heat.
+	missingOpen = "open"
+	// missingClosed rejects nodes without heat and fails the request when
+	// none of the nodes has heat.
+	missingClosed = "closed"
+	// missingImpute gives nodes without heat the median joules of the nodes
+	// with heat, it fails open when none of the nodes has heat.
+	missingImpute = "impute"
+
+	actionRankedLast = "ranked_last" // the node stayed a candidate behind the nodes with heat
+	actionPassedAll  = "passed_all"  // no node had heat and all nodes passed
+	actionRejected   = "rejected"    // the node was rejected
+	actionImputed    = "imputed"     // the node was given the median joules of its peers
+)
+
+// missingPolicy decides what happens to nodes without valid heat.
+type missingPolicy struct {
+	Policy     string            `json:"policy"`
+	Namespaces map[string]string `json:"namespaces"` // policy of pods in a namespace, overrides Policy
+}
+
+// validate returns an error if the policy or one of the namespace policies
+// is unknown.
+func (p missingPolicy) validate() error {
+	if !validMissingPolicy(p.Policy) {
+		return fmt.Errorf("unknown policy %q", p.Policy)
+	}
+	for ns, policy := range p.Namespaces {
+		if ns == "" {
+			return fmt.Errorf("namespace must not be empty")
+		}
+		if !validMissingPolicy(policy) {
+			return fmt.Errorf("unknown policy %q for namespace %v", policy, ns)
+		}
+	}
+	return nil
+}
+
+// validMissingPolicy returns whether policy is a known missing heat policy.
+func validMissingPolicy(policy string) bool {
+	return policy == missingOpen || policy == missingClosed || policy == missingImpute
+}
+
+// policyFor returns the policy applied to pods in a namespace.
+func (p missingPolicy) policyFor(namespace string) string {
+	if policy, ok := p.Namespaces[namespace]; ok {
+		return policy
+	}
+	return p.Policy
+}
+
+// missingOutcome is the result of applying the missing heat policy.
+type missingOutcome struct {
+	nodes   []candidate       // nodes that stay candidates, with imputed heat when the policy is impute
+	failed  map[string]string // nodes rejected by the policy and the reason why
+	passAll bool              // no node has heat and the policy lets all nodes pass
+}
+
+// applyMissing applies the missing heat policy of the namespace of pod to
+// nodes and counts the nodes without heat by policy and action, unless c is
+// a dry run.
+func applyMissing(c *config, pod *k8sApi.Pod, nodes []candidate) (missingOutcome, error) {
+	policy := c.Missing.policyFor(pod.Namespace)
+	m := missingOutcome{nodes: nodes, failed: make(map[string]string)}
+
+	missing := 0
+	for i := range nodes {
+		if nodes[i].err != nil {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return m, nil
+	}
+
+	if missing == len(nodes) {
+		if policy == missingClosed {
+			if !c.dryRun {
+				observeMissing(policy, actionRejected, missing)
+			}
+			for _, node := range nodes {
+				m.failed[node.Name] = fmt.Sprintf("node has no valid heat in %v and the missing heat policy is %v", c.source.Name(), policy)
+			}
+			return m, fmt.Errorf("none of the %v nodes has valid heat in %v and the missing heat policy of namespace %v is %v", len(nodes), c.source.Name(), pod.Namespace, policy)
+		}
+		infof("None of the %v nodes has valid heat in %v, passing all nodes for pod %v", len(nodes), c.source.Name(), pod.Name)
+		if !c.dryRun {
+			observeMissing(policy, actionPassedAll, missing)
+		}
+		m.passAll = true
+		return m, nil
+	}
+
+	switch policy {
+	case missingClosed:
+		if !c.dryRun {
+			observeMissing(policy, actionRejected, missing)
+		}
+		m.nodes = make([]candidate, 0, len(nodes)-missing)
+		for _, node := range nodes {
+			if node.err != nil {
+				m.failed[node.Name] = fmt.Sprintf("node has no valid heat in %v and the missing heat policy is %v", c.source.Name(), policy)
+				continue
+			}
+			m.nodes = append(m.nodes, node)
+		}
+	case missingImpute:
+		if !c.dryRun {
+			observeMissing(policy, actionImputed, missing)
+		}
+		m.nodes = imputeMissing(nodes)
+	default:
+		// the threshold modes reject nodes without heat in filterNodes.
+		action := actionRankedLast
+		if c.Filter.Mode != filterModeCoolest {
+			action = actionRejected
+		}
+		if !c.dryRun {
+			observeMissing(policy, action, missing)
+		}
+	}
+	return m, nil
+}
+
+// imputeMissing returns a copy of nodes in which nodes without heat have the
+// median joules of the nodes with heat. nodes is returned when no node has
+// heat.
+func imputeMissing(nodes []candidate) []candidate {
+	joules := []float64{}
+	for i := range nodes {
+		if nodes[i].err == nil {
+			joules = append(joules, nodes[i].reading.Joules)
+		}
+	}
+	if len(joules) == 0 || len(joules) == len(nodes) {
+		return nodes
+	}
+	sort.Float64s(joules)
+	median := joules[len(joules)/2]
+	if len(joules)%2 == 0 {
+		median = (joules[len(joules)/2-1] + joules[len(joules)/2]) / 2
+	}
+
+	imputed := make([]candidate, len(nodes))
+	for i, node := range nodes {
+		if node.err != nil {
+			node.reading = heatReading{Joules: median, Version: "imputed"}
+			node.err = nil
+			node.penalty = 0
+		}
+		imputed[i] = node
+	}
+	return imputed
+}
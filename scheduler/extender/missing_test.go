@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// TestMissingPolicy tests how each missing heat policy handles nodes without
+// heat.
+func TestMissingPolicy(t *testing.T) {
+	partial := newNodeList(newNode("node1", ""), newNode("node2", "50"), newNode("node3", "70"), newNode("node4", "illigal"))
+	none := newNodeList(newNode("node1", ""), newNode("node2", "illigal"))
+
+	testCases := map[string]struct {
+		policy   string
+		mode     filterPolicy
+		list     k8sApi.NodeList
+		expected []string
+		err      bool
+	}{
+		"open passes all without heat":    {missingOpen, filterPolicy{Mode: filterModeCoolest}, none, []string{"node1", "node2"}, false},
+		"open ranks missing last":         {missingOpen, filterPolicy{Mode: filterModeCoolest}, partial, []string{"node2"}, false},
+		"closed fails without heat":       {missingClosed, filterPolicy{Mode: filterModeCoolest}, none, nil, true},
+		"closed rejects missing":          {missingClosed, filterPolicy{Mode: filterModeCeiling, MaxJoules: 1000}, partial, []string{"node2", "node3"}, false},
+		"impute passes all without heat":  {missingImpute, filterPolicy{Mode: filterModeCoolest}, none, []string{"node1", "node2"}, false},
+		"impute uses median of peers":     {missingImpute, filterPolicy{Mode: filterModeBand, Band: 10}, partial, []string{"node1", "node2", "node4"}, false},
+		"open rejects missing in ceiling": {missingOpen, filterPolicy{Mode: filterModeCeiling, MaxJoules: 1000}, partial, []string{"node2", "node3"}, false},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.mode
+		c.Missing.Policy = tc.policy
+		pod := newPod("pod", nil)
+		nodes, failed, err := filterForPod(c, &pod, readCandidates(c, tc.list.Items))
+		if tc.err {
+			if err == nil {
+				t.Errorf("Test case %v: expected an error", desc)
+			}
+			if len(failed) != len(tc.list.Items) {
+				t.Errorf("Test case %v: expected every node to be rejected but got %v", desc, failed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		if len(nodes) != len(tc.expected) {
+			t.Errorf("Test case %v: expected %v but got %v nodes", desc, tc.expected, len(nodes))
+			continue
+		}
+		for i, node := range nodes {
+			if node.Name != tc.expected[i] {
+				t.Errorf("Test case %v: expected %v but got %v at %v", desc, tc.expected[i], node.Name, i)
+			}
+		}
+	}
+}
+
+// TestMissingPolicyNamespace tests that a namespace policy overrides the
+// global policy and that the nodes are counted.
+func TestMissingPolicyNamespace(t *testing.T) {
+	c := defaultConfig()
+	c.Missing = missingPolicy{
+		Policy:     missingOpen,
+		Namespaces: map[string]string{"critical": missingClosed},
+	}
+	list := newNodeList(newNode("node1", ""), newNode("node2", ""))
+
+	pod := newPod("pod", nil)
+	before := counterValue(t, missingHeatTotal.WithLabelValues(missingOpen, actionPassedAll))
+	if _, _, err := filterForPod(c, &pod, readCandidates(c, list.Items)); err != nil {
+		t.Errorf("Expected the default namespace to fail open: %v", err)
+	}
+	if n := counterValue(t, missingHeatTotal.WithLabelValues(missingOpen, actionPassedAll)); n != before+2 {
+		t.Errorf("Expected 2 nodes to be counted as passed but got %v", n-before)
+	}
+
+	pod.Namespace = "critical"
+	before = counterValue(t, missingHeatTotal.WithLabelValues(missingClosed, actionRejected))
+	if _, _, err := filterForPod(c, &pod, readCandidates(c, list.Items)); err == nil {
+		t.Errorf("Expected the critical namespace to fail closed")
+	}
+	if n := counterValue(t, missingHeatTotal.WithLabelValues(missingClosed, actionRejected)); n != before+2 {
+		t.Errorf("Expected 2 nodes to be counted as rejected but got %v", n-before)
+	}
+}
+
+// TestMissingPolicyOpenCount tests that the open policy counts nodes without
+// heat as ranked last in coolest mode and as rejected in the threshold modes,
+// which reject them.
+func TestMissingPolicyOpenCount(t *testing.T) {
+	list := newNodeList(newNode("node1", ""), newNode("node2", "50"))
+	testCases := map[string]struct {
+		mode   filterPolicy
+		action string
+	}{
+		"coolest": {filterPolicy{Mode: filterModeCoolest}, actionRankedLast},
+		"ceiling": {filterPolicy{Mode: filterModeCeiling, MaxJoules: 1000}, actionRejected},
+		"band":    {filterPolicy{Mode: filterModeBand, Band: 10}, actionRejected},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = tc.mode
+		pod := newPod("pod", nil)
+		before := counterValue(t, missingHeatTotal.WithLabelValues(missingOpen, tc.action))
+		_, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		if _, ok := failed["node1"]; !ok {
+			t.Errorf("Test case %v: expected node1 to be rejected", desc)
+		}
+		if n := counterValue(t, missingHeatTotal.WithLabelValues(missingOpen, tc.action)); n != before+1 {
+			t.Errorf("Test case %v: expected 1 node to be counted as %v but got %v", desc, tc.action, n-before)
+		}
+	}
+}
+
+// TestImputeMissing tests that nodes without heat get the median joules of
+// their peers.
+func TestImputeMissing(t *testing.T) {
+	testCases := map[string]struct {
+		list     k8sApi.NodeList
+		expected float64
+	}{
+		"odd peers":  {newNodeList(newNode("node1", ""), newNode("node2", "10"), newNode("node3", "30"), newNode("node4", "20")), 20},
+		"even peers": {newNodeList(newNode("node1", ""), newNode("node2", "10"), newNode("node3", "30")), 20},
+		"one peer":   {newNodeList(newNode("node1", "illigal"), newNode("node2", "10")), 10},
+	}
+
+	for desc, tc := range testCases {
+		nodes := imputeMissing(readCandidates(defaultConfig(), tc.list.Items))
+		if j := nodes[0].heat(); j != tc.expected {
+			t.Errorf("Test case %v: expected %v joules but got %v", desc, tc.expected, j)
+		}
+	}
+}
+
+// TestMissingPolicyValidate tests that unknown policies are rejected.
+func TestMissingPolicyValidate(t *testing.T) {
+	testCases := map[string]struct {
+		policy missingPolicy
+		valid  bool
+	}{
+		"open":              {missingPolicy{Policy: missingOpen}, true},
+		"namespace closed":  {missingPolicy{Policy: missingOpen, Namespaces: map[string]string{"a": missingClosed}}, true},
+		"unknown":           {missingPolicy{Policy: "ignore"}, false},
+		"unknown namespace": {missingPolicy{Policy: missingOpen, Namespaces: map[string]string{"a": "ignore"}}, false},
+		"empty namespace":   {missingPolicy{Policy: missingOpen, Namespaces: map[string]string{"": missingOpen}}, false},
+	}
+
+	for desc, tc := range testCases {
+		if err := tc.policy.validate(); (err == nil) != tc.valid {
+			t.Errorf("Test case %v: expected valid=%v but got %v", desc, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// errNodeCacheNotSynced is returned when node names are resolved before the
+// node cache holds a full list of nodes.
+var errNodeCacheNotSynced = errors.New("node cache is not synced yet")
+
+// nodeCacheConfig configures the node cache used by the node-name-only
+// protocol, in which the scheduler sends the names of the candidate nodes
+// instead of the nodes. The scheduler uses that protocol for extenders
+// configured with nodeCacheCapable, which needs a scheduler of kubernetes 1.6
+// or later. The v1.2 scheduler deployed from scheduler/scheduler does not know
+// the setting and always sends the nodes. The nodes are also watched when a
+// power budget is set, as the budget covers every node of the cluster.
+type nodeCacheConfig struct {
+	Enabled   bool   `json:"enabled"`   // watch the nodes and accept requests carrying node names
+	APIServer string `json:"apiServer"` // address of the API server the nodes are watched on, empty uses the in-cluster config
+}
+
+// nodeCache holds the nodes of the cluster by name. It is kept up to date by
+// a watcher of the nodes.
+type nodeCache struct {
+	mu     sync.RWMutex           // guards the fields below
+	nodes  map[string]k8sApi.Node // nodes by name
+	synced bool                   // whether the cache holds a full list of nodes
+}
+
+// watchesNodes returns whether c needs the nodes of the cluster to be
+// watched, for the node-name-only protocol or for the power budget.
+func (c *config) watchesNodes() bool {
+	return c.NodeCache.Enabled || c.Budget.MaxWatts > 0
+}
+
+// cachedNodes is the node cache shared by all handlers.
+var cachedNodes = newNodeCache()
+
+// newNodeCache returns an empty node cache that is not synced.
+func newNodeCache() *nodeCache {
+	return &nodeCache{nodes: make(map[string]k8sApi.Node)}
+}
+
+// replace replaces the content of the cache with a full list of nodes and
+// marks the cache synced.
+func (n *nodeCache) replace(list []k8sApi.Node) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes = make(map[string]k8sApi.Node, len(list))
+	for _, node := range list {
+		n.nodes[node.Name] = node
+	}
+	n.synced = true
+}
+
+// update adds, updates or removes a node.
+func (n *nodeCache) update(node *k8sApi.Node, deleted bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if deleted {
+		delete(n.nodes, node.Name)
+		return
+	}
+	n.nodes[node.Name] = *node
+}
+
+// lookup returns the nodes with the given names in the same order. A name
+// the cache does not know yet is returned as a node without labels, so it
+// has no heat and the missing heat policy decides what happens to it.
+func (n *nodeCache) lookup(names []string) ([]k8sApi.Node, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if !n.synced {
+		return nil, errNodeCacheNotSynced
+	}
+	nodes := make([]k8sApi.Node, len(names))
+	for i, name := range names {
+		node, ok := n.nodes[name]
+		if !ok {
+			debugf("Node %v is not in the node cache yet", name)
+			node = k8sApi.Node{ObjectMeta: k8sApi.ObjectMeta{Name: name}}
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// all returns every node in the cache and whether the cache is synced.
+func (n *nodeCache) all() ([]k8sApi.Node, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	nodes := make([]k8sApi.Node, 0, len(n.nodes))
+	for _, node := range n.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, n.synced
+}
+
+// hasSynced returns whether the cache holds a full list of nodes.
+func (n *nodeCache) hasSynced() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.synced
+}
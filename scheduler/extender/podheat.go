@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// podHeatAnnotation is the pod annotation declaring the energy in joules
+	// a pod is expected to add to its node per hour.
+	podHeatAnnotation = "heat-scheduling/joules-per-hour"
+)
+
+// podHeatPolicy decides how much heat a pod is expected to add to a node and
+// how warm a node may become.
+type podHeatPolicy struct {
+	JoulesPerCPUHour float64  `json:"joulesPerCPUHour"` // default per requested CPU for pods without annotation
+	Horizon          duration `json:"horizon"`          // time over which the heat of a pod is projected
+	MaxProjected     float64  `json:"maxProjected"`     // max joules of a node after placing the pod, 0 disables the check
+}
+
+// validate returns an error if the policy can not be used to project heat.
+func (p podHeatPolicy) validate() error {
+	if p.JoulesPerCPUHour < 0 {
+		return fmt.Errorf("joules per CPU hour must not be negative, got %v", p.JoulesPerCPUHour)
+	}
+	if p.Horizon.Duration <= 0 {
+		return fmt.Errorf("projection horizon must be positive, got %v", p.Horizon)
+	}
+	if p.MaxProjected < 0 {
+		return fmt.Errorf("max projected joules must not be negative, got %v", p.MaxProjected)
+	}
+	return nil
+}
+
+// projectedHeat returns the joules a pod is expected to add to its node over
+// the horizon. The pod annotation takes precedence over the per CPU default.
+func (p podHeatPolicy) projectedHeat(pod *k8sApi.Pod) (float64, error) {
+	perHour := p.JoulesPerCPUHour * podCPURequest(pod)
+	if value, ok := pod.Annotations[podHeatAnnotation]; ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return 0, fmt.Errorf("annotation %v=%q of pod %v is not a non-negative number", podHeatAnnotation, value, pod.Name)
+		}
+		perHour = parsed
+	}
+	return perHour * p.Horizon.Hours(), nil
+}
+
+// podCPURequest returns the number of CPUs requested by all containers of a pod.
+func podCPURequest(pod *k8sApi.Pod) float64 {
+	milli := int64(0)
+	for _, c := range pod.Spec.Containers {
+		if cpu, ok := c.Resources.Requests[k8sApi.ResourceCPU]; ok {
+			milli += cpu.MilliValue()
+		}
+	}
+	return float64(milli) / 1000
+}
+
+// filterProjected splits nodes into nodes that stay at or below the max
+// projected joules after placing the pod and a map from the name of every
+// rejected node to the reason. Nodes without a valid joules label can not be
+// projected and are passed on.
+func filterProjected(c *config, nodes []candidate, pod *k8sApi.Pod) ([]candidate, map[string]string, error) {
+	p := c.PodHeat
+	failed := make(map[string]string)
+	if p.MaxProjected == 0 {
+		return nodes, failed, nil
+	}
+	heat, err := p.projectedHeat(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passed := []candidate{}
+	for _, node := range nodes {
+		joules := node.joules()
+		if joules != math.MaxFloat64 && joules+heat > p.MaxProjected {
+			failed[node.Name] = fmt.Sprintf("projected joules %.2f (%.2f + %.2f from pod) exceed the max of %v", joules+heat, joules, heat, p.MaxProjected)
+			continue
+		}
+		passed = append(passed, node)
+	}
+	return passed, failed, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// TestProjectedHeat tests projectedHeat using different pods.
+func TestProjectedHeat(t *testing.T) {
+	p := podHeatPolicy{JoulesPerCPUHour: 10, Horizon: duration{30 * time.Minute}}
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		expected float64
+		fail     bool
+	}{
+		"no requests": {
+			pod:      newPod("pod", nil),
+			expected: 0,
+		},
+		"cpu requests": {
+			pod:      newPod("pod", nil, "500m", "1500m"),
+			expected: 10,
+		},
+		"annotation": {
+			pod:      newPod("pod", map[string]string{podHeatAnnotation: "40"}, "2"),
+			expected: 20,
+		},
+		"illigal annotation": {
+			pod:  newPod("pod", map[string]string{podHeatAnnotation: "illigal"}),
+			fail: true,
+		},
+		"negative annotation": {
+			pod:  newPod("pod", map[string]string{podHeatAnnotation: "-5"}),
+			fail: true,
+		},
+	}
+
+	for desc, tc := range testCases {
+		heat, err := p.projectedHeat(&tc.pod)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("Test case %v: expected error", desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error when testing case %v: %v", desc, err)
+			continue
+		}
+		if heat != tc.expected {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, heat)
+		}
+	}
+}
+
+// TestFilterForPodProjected tests that nodes the pod would heat beyond the max
+// projected joules are rejected.
+func TestFilterForPodProjected(t *testing.T) {
+	c := defaultConfig()
+	c.PodHeat.MaxProjected = 70
+	c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 100}
+
+	list := newNodeList(
+		newNode("node1", "50"),
+		newNode("node2", "60"),
+		newNode("node3", "65"),
+	)
+	pod := newPod("batch", map[string]string{podHeatAnnotation: "8"})
+	nodes, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	if len(nodes) != 2 || nodes[0].Name != "node1" || nodes[1].Name != "node2" {
+		t.Errorf("Expected node1 and node2 to pass but got %v", nodes)
+	}
+	if _, ok := failed["node3"]; !ok {
+		t.Errorf("Expected a reason for rejecting node3 but got %v", failed)
+	}
+
+	heavy := newPod("heavy", map[string]string{podHeatAnnotation: "30"})
+	if _, failed, err = filterForPod(c, &heavy, readCandidates(c, list.Items)); err == nil {
+		t.Errorf("Expected error when all nodes would exceed the max")
+	} else if len(failed) != 3 {
+		t.Errorf("Expected reasons for all 3 nodes but got %v", failed)
+	}
+}
+
+// TestFilterForPodProjectedError tests that the reasons collected before the
+// heat of a pod fails to project are returned with the error.
+func TestFilterForPodProjectedError(t *testing.T) {
+	defer func(n *criticalTracker) { critical = n }(critical)
+	critical = newCriticalTracker()
+
+	c := defaultConfig()
+	c.PodHeat.MaxProjected = 70
+	c.Critical = criticalPolicy{MaxJoules: 100}
+	c.Missing.Policy = missingClosed
+
+	list := newNodeList(
+		newNode("node1", "50"),
+		newNode("node2", "150"),
+		newNode("node3", ""),
+	)
+	pod := newPod("batch", map[string]string{podHeatAnnotation: "lots"})
+	if _, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items)); err == nil {
+		t.Errorf("Expected error for an invalid %v annotation", podHeatAnnotation)
+	} else if failed["node2"] == "" || failed["node3"] == "" {
+		t.Errorf("Expected the critical and missing heat reasons to be kept but got %v", failed)
+	}
+}
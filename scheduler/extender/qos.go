@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sResource "k8s.io/kubernetes/pkg/api/resource"
+)
+
+const (
+	qosGuaranteed = "Guaranteed" // every container has cpu and memory limits equal to its requests
+	qosBurstable  = "Burstable"  // some container has requests or limits, but the pod is not guaranteed
+	qosBestEffort = "BestEffort" // no container has requests or limits
+)
+
+// qosPolicy adjusts placement to the kubernetes QoS class of a pod, derived
+// from the resource requests and limits of its containers.
+type qosPolicy struct {
+	Enabled         bool    `json:"enabled"`
+	StrictCPU       float64 `json:"strictCPU"`       // CPUs a guaranteed pod must request to be placed on the coolest node, 0 places every guaranteed pod there
+	BestEffortClass string  `json:"bestEffortClass"` // heat class of best effort pods that name no class
+}
+
+// validate returns an error describing the first invalid setting of p, given
+// the heat classes of the config. When the policy is enabled the best effort
+// class must prefer warm nodes, and so have a limit, or best effort pods
+// would be placed as before.
+func (p qosPolicy) validate(classes classPolicy) error {
+	if p.StrictCPU < 0 {
+		return fmt.Errorf("strict CPU must not be negative, got %v", p.StrictCPU)
+	}
+	class, ok := classes.Classes[p.BestEffortClass]
+	if !ok {
+		return fmt.Errorf("best effort class %q is not a heat class", p.BestEffortClass)
+	}
+	if p.Enabled && class.Prefer != preferWarm {
+		return fmt.Errorf("best effort class %v prefers %v nodes, expected a class preferring %v nodes", p.BestEffortClass, class.Prefer, preferWarm)
+	}
+	return nil
+}
+
+// podQOS returns the QoS class of a pod, following the rules of the kubelet.
+// Requests default to limits when they are not set.
+func podQOS(pod *k8sApi.Pod) string {
+	requests, limits, guaranteed := 0, 0, true
+	for _, c := range pod.Spec.Containers {
+		for _, name := range []k8sApi.ResourceName{k8sApi.ResourceCPU, k8sApi.ResourceMemory} {
+			limit, hasLimit := c.Resources.Limits[name]
+			request, hasRequest := c.Resources.Requests[name]
+			if hasLimit && limit.Cmp(k8sResource.Quantity{}) != 0 {
+				limits++
+			} else {
+				guaranteed = false
+			}
+			if hasRequest && request.Cmp(k8sResource.Quantity{}) != 0 {
+				requests++
+				if !hasLimit || request.Cmp(limit) != 0 {
+					guaranteed = false
+				}
+			}
+		}
+	}
+	switch {
+	case requests == 0 && limits == 0:
+		return qosBestEffort
+	case guaranteed:
+		return qosGuaranteed
+	}
+	return qosBurstable
+}
+
+// withQOS returns a copy of c that places pod according to its QoS class.
+// Guaranteed pods requesting at least the strict CPUs are placed on the
+// coolest node whatever the filter mode and strategy. Best effort pods that
+// name no heat class get the best effort class. c must hold the heat class of
+// pod, see withClass. c is returned when the policy is disabled.
+func withQOS(c *config, pod *k8sApi.Pod) *config {
+	if !c.QOS.Enabled {
+		return c
+	}
+	adjusted := *c
+	switch podQOS(pod) {
+	case qosGuaranteed:
+		if podCPURequest(pod) < c.QOS.StrictCPU {
+			return c
+		}
+		adjusted.Filter = filterPolicy{Mode: filterModeCoolest}
+		adjusted.strategy = coolestStrategy{}
+		if adjusted.class != nil && adjusted.class.Prefer != preferCool {
+			class := *adjusted.class
+			class.Prefer = preferCool
+			adjusted.class = &class
+		}
+	case qosBestEffort:
+		if c.class == nil || c.class.named {
+			return c
+		}
+		adjusted.class = &podClass{heatClass: c.HeatClasses.Classes[c.QOS.BestEffortClass], name: c.QOS.BestEffortClass}
+	default:
+		return c
+	}
+	return &adjusted
+}
+
+// minCPURequest is the number of CPUs a pod without CPU requests is assumed to
+// use when its heat is reserved. The kubernetes scheduler assumes the same
+// 100m for such pods when it spreads them over nodes.
+const minCPURequest = 0.1
+
+// reservesHeat returns whether placements reserve heat in the ledger, which
+// they do for a positive reservation penalty and for the heat the QoS policy
+// expects pods to add.
+func (c *config) reservesHeat() bool {
+	return c.Reservations.Penalty > 0 || c.QOS.Enabled
+}
+
+// reservedHeat returns the joules a placement of pod reserves on its node.
+// With the QoS policy enabled this is the heat the pod is expected to add,
+// which scales with its requested CPUs. Pods without CPU requests, such as
+// best effort pods, are taken to request minCPURequest. The reservation
+// penalty is used when the policy is disabled or the pod heat policy projects
+// no heat.
+func reservedHeat(c *config, pod *k8sApi.Pod) float64 {
+	if !c.QOS.Enabled {
+		return c.Reservations.Penalty
+	}
+	heat, err := c.PodHeat.projectedHeat(pod)
+	if _, annotated := pod.Annotations[podHeatAnnotation]; err == nil && !annotated && podCPURequest(pod) == 0 {
+		heat = c.PodHeat.JoulesPerCPUHour * minCPURequest * c.PodHeat.Horizon.Hours()
+	}
+	if err != nil || heat <= 0 {
+		return c.Reservations.Penalty
+	}
+	return heat
+}
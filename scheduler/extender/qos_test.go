@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sResource "k8s.io/kubernetes/pkg/api/resource"
+)
+
+// newQOSPod returns a pod with one container with the given cpu and memory
+// requests and limits, empty values are left unset.
+func newQOSPod(name string, annotations map[string]string, cpuRequest, cpuLimit, memRequest, memLimit string) k8sApi.Pod {
+	pod := newPod(name, annotations)
+	requests, limits := k8sApi.ResourceList{}, k8sApi.ResourceList{}
+	for _, r := range []struct {
+		list  k8sApi.ResourceList
+		name  k8sApi.ResourceName
+		value string
+	}{
+		{requests, k8sApi.ResourceCPU, cpuRequest},
+		{limits, k8sApi.ResourceCPU, cpuLimit},
+		{requests, k8sApi.ResourceMemory, memRequest},
+		{limits, k8sApi.ResourceMemory, memLimit},
+	} {
+		if r.value != "" {
+			r.list[r.name] = k8sResource.MustParse(r.value)
+		}
+	}
+	pod.Spec.Containers = []k8sApi.Container{{Resources: k8sApi.ResourceRequirements{Requests: requests, Limits: limits}}}
+	return pod
+}
+
+// TestPodQOS tests that pods are sorted into the QoS classes of the kubelet.
+func TestPodQOS(t *testing.T) {
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		expected string
+	}{
+		"no containers":       {newPod("pod", nil), qosBestEffort},
+		"no resources":        {newQOSPod("pod", nil, "", "", "", ""), qosBestEffort},
+		"cpu request":         {newPod("pod", nil, "1"), qosBurstable},
+		"requests equal":      {newQOSPod("pod", nil, "2", "2", "1Gi", "1Gi"), qosGuaranteed},
+		"limits only":         {newQOSPod("pod", nil, "", "2", "", "1Gi"), qosGuaranteed},
+		"requests below":      {newQOSPod("pod", nil, "1", "2", "1Gi", "1Gi"), qosBurstable},
+		"memory limit absent": {newQOSPod("pod", nil, "2", "2", "1Gi", ""), qosBurstable},
+	}
+
+	for desc, tc := range testCases {
+		if qos := podQOS(&tc.pod); qos != tc.expected {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, qos)
+		}
+	}
+}
+
+// TestQOSPlacement tests that large guaranteed pods are placed on the coolest
+// node and that best effort pods are steered to warm nodes.
+func TestQOSPlacement(t *testing.T) {
+	list := newNodeList(
+		newNode("node1", "10"),
+		newNode("node2", "20"),
+		newNode("node3", "60"),
+	)
+
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		enabled  bool
+		expected []string
+	}{
+		"large guaranteed":  {newQOSPod("pod", nil, "4", "4", "1Gi", "1Gi"), true, []string{"node1"}},
+		"small guaranteed":  {newQOSPod("pod", nil, "1", "1", "1Gi", "1Gi"), true, []string{"node1", "node2"}},
+		"burstable":         {newPod("pod", nil, "4"), true, []string{"node1", "node2"}},
+		"best effort":       {newPod("pod", nil), true, []string{"node2", "node3"}},
+		"named best effort": {newPod("pod", map[string]string{defaultClassKey: classSensitive}), true, []string{"node1", "node2"}},
+		"disabled":          {newQOSPod("pod", nil, "4", "4", "1Gi", "1Gi"), false, []string{"node1", "node2"}},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Filter = filterPolicy{Mode: filterModeBand, Band: 40}
+		c.HeatClasses.Classes = warmClasses(100)
+		c.QOS = qosPolicy{Enabled: tc.enabled, StrictCPU: 2, BestEffortClass: classTolerant}
+		passed, _, err := filterForPod(c, &tc.pod, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		names := []string{}
+		for _, node := range passed {
+			names = append(names, node.Name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, names)
+		}
+	}
+}
+
+// TestReservedHeat tests that with QoS awareness a placement reserves the
+// heat the pod is expected to add, which scales with its requested CPUs, and
+// that pods without CPU requests reserve the heat of the minimum request.
+func TestReservedHeat(t *testing.T) {
+	testCases := map[string]struct {
+		pod        k8sApi.Pod
+		enabled    bool
+		perCPUHour float64
+		expected   float64
+	}{
+		"one cpu":              {newPod("pod", nil, "1"), true, 100, 100},
+		"four cpus":            {newQOSPod("pod", nil, "4", "4", "1Gi", "1Gi"), true, 100, 400},
+		"best effort":          {newPod("pod", nil), true, 100, 10},
+		"memory only":          {newQOSPod("pod", nil, "", "", "1Gi", "1Gi"), true, 100, 10},
+		"annotated":            {newPod("pod", map[string]string{podHeatAnnotation: "30"}), true, 100, 30},
+		"no heat per cpu":      {newPod("pod", nil), true, 0, 5},
+		"invalid annotation":   {newPod("pod", map[string]string{podHeatAnnotation: "lots"}), true, 100, 5},
+		"disabled":             {newPod("pod", nil, "4"), false, 100, 5},
+		"disabled best effort": {newPod("pod", nil), false, 100, 5},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Reservations.Penalty = 5
+		c.PodHeat.JoulesPerCPUHour = tc.perCPUHour
+		c.QOS.Enabled = tc.enabled
+		if heat := reservedHeat(c, &tc.pod); math.Abs(heat-tc.expected) > 1e-9 {
+			t.Errorf("Test case %v: expected %v joules but got %v", desc, tc.expected, heat)
+		}
+	}
+}
+
+// TestQOSReservesWithoutPenalty tests that the ledger records the heat of
+// placements when QoS aware without a reservation penalty.
+func TestQOSReservesWithoutPenalty(t *testing.T) {
+	defer func(l *reservations) { ledger = l }(ledger)
+	defer setConfig(currentConfig())
+	ledger = newReservations(false, time.Minute)
+	c := defaultConfig()
+	c.HeatClasses.Classes = warmClasses(100)
+	c.QOS.Enabled = true
+	c.PodHeat.JoulesPerCPUHour = 100
+	setConfig(c)
+	now := time.Unix(0, 0)
+	ledger.now = fakeClock(&now)
+
+	pod := newPod("pod", nil, "1")
+	ledger.reserveJoules("node1", "50", reservedHeat(c, &pod))
+	if p := ledger.penaltyFor("node1", "50"); p != 100 {
+		t.Errorf("Expected a penalty of 100 but got %v", p)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// reservation records a single placement on a node.
+type reservation struct {
+	placed time.Time // when the placement was made
+	label  string    // joules label of the node at the time of the placement
+	joules float64   // penalty of the placement before it decays
+}
+
+// reservations is a ledger of recent placements. The joules label of a node
+// is only updated by the monitor every few seconds, so every placement adds a
+// provisional heat penalty to the chosen node. The penalty decays linearly to
+// zero and is dropped as soon as the monitor publishes a new joules label.
+type reservations struct {
+	mu      sync.Mutex               // guards the fields below
+	enabled bool                     // whether placements are recorded
+	decay   time.Duration            // time after which a placement no longer adds a penalty
+	now     func() time.Time         // returns the current time, replaced in tests
+	entries map[string][]reservation // placements by node name
+}
+
+// ledger is the reservation ledger shared by all handlers.
+var ledger = newReservations(false, 30*time.Second)
+
+// newReservations returns an empty ledger.
+func newReservations(enabled bool, decay time.Duration) *reservations {
+	return &reservations{
+		enabled: enabled,
+		decay:   decay,
+		now:     time.Now,
+		entries: make(map[string][]reservation),
+	}
+}
+
+// configure enables or disables the ledger and changes the decay, placements
+// already made are kept.
+func (r *reservations) configure(enabled bool, decay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = enabled
+	r.decay = decay
+}
+
+// reserveJoules records a placement that adds the given penalty on the node
+// with the given name and current joules label. The ledger must be enabled,
+// see config.reservesHeat.
+func (r *reservations) reserveJoules(name, label string, joules float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.enabled || joules <= 0 {
+		return
+	}
+	active := r.active(name, label)
+	r.entries[name] = append(active, reservation{placed: r.now(), label: label, joules: joules})
+}
+
+// penaltyFor returns the provisional joules to add to the joules label of the
+// node with the given name.
+func (r *reservations) penaltyFor(name, label string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.enabled {
+		return 0
+	}
+	active := r.active(name, label)
+	if len(active) == 0 {
+		delete(r.entries, name)
+		return 0
+	}
+	r.entries[name] = active
+
+	now := r.now()
+	total := 0.0
+	for _, res := range active {
+		age := now.Sub(res.placed)
+		total += res.joules * (1 - float64(age)/float64(r.decay))
+	}
+	return total
+}
+
+// active returns the placements on a node that have not decayed and were made
+// while the node had its current label. r.mu must be held.
+func (r *reservations) active(name, label string) []reservation {
+	now := r.now()
+	active := []reservation{}
+	for _, res := range r.entries[name] {
+		if res.label == label && now.Sub(res.placed) < r.decay {
+			active = append(active, res)
+		}
+	}
+	return active
+}
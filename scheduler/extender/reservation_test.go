@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
+)
+
+// fakeClock returns a clock function that returns the time pointed to by now.
+func fakeClock(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+// TestReservationsPenalty tests that penalties add up, decay and are dropped
+// when the joules label changes.
+func TestReservationsPenalty(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newReservations(true, 10*time.Second)
+	r.now = fakeClock(&now)
+	node := newNode("node1", "50")
+
+	if p := r.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != 0 {
+		t.Errorf("Expected no penalty without placements but got %v", p)
+	}
+
+	r.reserveJoules(node.Name, node.Labels[defaultLabelKey], 10)
+	r.reserveJoules(node.Name, node.Labels[defaultLabelKey], 10)
+	if p := r.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != 20 {
+		t.Errorf("Expected penalty 20 after two placements but got %v", p)
+	}
+
+	now = now.Add(5 * time.Second)
+	if p := r.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != 10 {
+		t.Errorf("Expected penalty 10 after half the decay but got %v", p)
+	}
+
+	now = now.Add(5 * time.Second)
+	if p := r.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != 0 {
+		t.Errorf("Expected no penalty after the decay but got %v", p)
+	}
+
+	r.reserveJoules(node.Name, node.Labels[defaultLabelKey], 10)
+	updated := newNode("node1", "55")
+	if p := r.penaltyFor(updated.Name, updated.Labels[defaultLabelKey]); p != 0 {
+		t.Errorf("Expected no penalty after the label was updated but got %v", p)
+	}
+}
+
+// TestReservationsDisabled tests that a disabled ledger records nothing.
+func TestReservationsDisabled(t *testing.T) {
+	r := newReservations(false, 10*time.Second)
+	node := newNode("node1", "50")
+	r.reserveJoules(node.Name, node.Labels[defaultLabelKey], 10)
+	if p := r.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != 0 {
+		t.Errorf("Expected no penalty but got %v", p)
+	}
+	if len(r.entries) != 0 {
+		t.Errorf("Expected no entries but got %v", len(r.entries))
+	}
+}
+
+// TestReservationsSpread tests that a burst of placements spreads over nodes.
+func TestReservationsSpread(t *testing.T) {
+	defer func(l *reservations) { ledger = l }(ledger)
+	now := time.Unix(0, 0)
+	ledger = newReservations(true, time.Minute)
+	ledger.now = fakeClock(&now)
+
+	list := newNodeList(
+		newNode("node1", "50"),
+		newNode("node2", "60"),
+		newNode("node3", "70"),
+	)
+	expected := []string{"node1", "node2", "node1", "node3"}
+	for i, name := range expected {
+		c := defaultConfig()
+		nodes, _, err := filterNodes(c, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Placement %v: unexpected error: %v", i, err)
+			return
+		}
+		if nodes[0].Name != name {
+			t.Errorf("Placement %v: expected %v but got %v", i, name, nodes[0].Name)
+		}
+		ledger.reserveJoules(nodes[0].Name, nodes[0].Labels[defaultLabelKey], 15)
+	}
+}
+
+// TestReservationsConcurrent tests that the ledger is safe under concurrent
+// requests, run with -race to detect data races.
+func TestReservationsConcurrent(t *testing.T) {
+	r := newReservations(true, time.Minute)
+	node := newNode("node1", "50")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.reserveJoules(node.Name, node.Labels[defaultLabelKey], 1)
+			r.penaltyFor(node.Name, node.Labels[defaultLabelKey])
+		}()
+	}
+	wg.Wait()
+
+	if n := len(r.entries["node1"]); n != 50 {
+		t.Errorf("Expected 50 placements but got %v", n)
+	}
+}
+
+// TestPrioritizeReserves tests that prioritize reserves heat on the top
+// scored node when it is given several nodes, so back-to-back pods in the
+// threshold modes spread over nodes.
+func TestPrioritizeReserves(t *testing.T) {
+	defer func(l *reservations) { ledger = l }(ledger)
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Filter = filterPolicy{Mode: filterModeBand, Band: 50}
+	c.Reservations.Penalty = 15
+	c.Exemptions.Annotation = true
+	setConfig(c)
+
+	testCases := map[string]struct {
+		pod      k8sApi.Pod
+		nodes    k8sApi.NodeList
+		expected map[string]float64
+	}{
+		"several nodes": {
+			newPod("web", nil),
+			newNodeList(newNode("node1", "60"), newNode("node2", "50"), newNode("node3", "70")),
+			map[string]float64{"node1": 0, "node2": 15, "node3": 0},
+		},
+		"single node": {
+			newPod("web", nil),
+			newNodeList(newNode("node1", "60")),
+			map[string]float64{"node1": 0},
+		},
+		"bypass": {
+			newPod("web", map[string]string{podExemptAnnotation: exemptBypass}),
+			newNodeList(newNode("node1", "60"), newNode("node2", "50")),
+			map[string]float64{"node1": 0, "node2": 0},
+		},
+	}
+
+	for desc, tc := range testCases {
+		now := time.Unix(0, 0)
+		ledger = newReservations(true, time.Minute)
+		ledger.now = fakeClock(&now)
+
+		b, err := json.Marshal(&k8sSchedulerApi.ExtenderArgs{Pod: tc.pod, Nodes: tc.nodes})
+		if err != nil {
+			t.Fatalf("Error when trying to convert args to bytes: %v", err)
+		}
+		req, err := http.NewRequest("POST", "/prioritize", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		prioritize(httptest.NewRecorder(), req)
+
+		for _, node := range tc.nodes.Items {
+			if p := ledger.penaltyFor(node.Name, node.Labels[defaultLabelKey]); p != tc.expected[node.Name] {
+				t.Errorf("Test case %v: expected penalty %v on %v but got %v", desc, tc.expected[node.Name], node.Name, p)
+			}
+		}
+	}
+}
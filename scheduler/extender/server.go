@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// serverConfig configures the HTTP server. The timeouts take effect at
+// startup, the body size and concurrency limits are read for every request.
+type serverConfig struct {
+	ReadTimeout     duration `json:"readTimeout"`     // time allowed to read a request including its body
+	WriteTimeout    duration `json:"writeTimeout"`    // time allowed from the end of reading a request to the end of its response
+	IdleTimeout     duration `json:"idleTimeout"`     // time a keep-alive connection may stay idle
+	ShutdownTimeout duration `json:"shutdownTimeout"` // time requests in flight get to finish on SIGTERM
+	MaxBodyBytes    int64    `json:"maxBodyBytes"`    // largest request body accepted by the scheduler verbs
+	MaxInFlight     int      `json:"maxInFlight"`     // scheduler requests served at once, 0 disables the limit
+}
+
+// validate returns an error describing the first invalid setting of s.
+func (s *serverConfig) validate() error {
+	timeouts := []struct {
+		name string
+		d    duration
+	}{
+		{"read timeout", s.ReadTimeout},
+		{"write timeout", s.WriteTimeout},
+		{"idle timeout", s.IdleTimeout},
+		{"shutdown timeout", s.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d.Duration <= 0 {
+			return fmt.Errorf("%v must be positive, got %v", t.name, t.d)
+		}
+	}
+	if s.MaxBodyBytes <= 0 {
+		return fmt.Errorf("max body bytes must be positive, got %v", s.MaxBodyBytes)
+	}
+	if s.MaxInFlight < 0 {
+		return fmt.Errorf("max in flight must not be negative, got %v", s.MaxInFlight)
+	}
+	return nil
+}
+
+// inFlight is the number of scheduler requests currently being served.
+var inFlight int64
+
+// limitRequest wraps a scheduler verb so it sheds load and rejects oversized
+// bodies. A request above the concurrency limit is answered with status 503
+// right away, so the scheduler fails fast instead of waiting out its
+// HTTPTimeout.
+func limitRequest(verb string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := currentConfig()
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+
+		if c.Server.MaxInFlight > 0 && n > int64(c.Server.MaxInFlight) {
+			errorf("Shedding %v request, %v requests in flight exceed the limit of %v", verb, n-1, c.Server.MaxInFlight)
+			requestsTotal.WithLabelValues(verb, outcomeShed).Inc()
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusServiceUnavailable, &errorResponse{
+				Error: fmt.Sprintf("heat scheduler is overloaded, %v requests in flight", n-1),
+			})
+			return
+		}
+		if r.ContentLength > c.Server.MaxBodyBytes {
+			errorf("Rejecting %v request with a body of %v bytes", verb, r.ContentLength)
+			requestsTotal.WithLabelValues(verb, outcomeBadRequest).Inc()
+			writeJSON(w, http.StatusRequestEntityTooLarge, &errorResponse{
+				Error: fmt.Sprintf("request body of %v bytes exceeds the limit of %v bytes", r.ContentLength, c.Server.MaxBodyBytes),
+			})
+			return
+		}
+		// bodies without a content length fail to decode once they pass the limit.
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, c.Server.MaxBodyBytes)
+		}
+		h(w, r)
+	}
+}
+
+// newServer returns a server for handler with the timeouts of c.
+func newServer(c *config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         c.Address,
+		Handler:      handler,
+		ReadTimeout:  c.Server.ReadTimeout.Duration,
+		WriteTimeout: c.Server.WriteTimeout.Duration,
+		IdleTimeout:  c.Server.IdleTimeout.Duration,
+	}
+}
+
+// serve serves svr on ln until serving fails or a signal arrives on stop.
+// On a signal the extender reports that it is not ready, stops accepting
+// connections and waits at most grace for the requests in flight. HTTPS is
+// served when svr has a TLS config.
+func serve(svr *http.Server, ln net.Listener, stop <-chan os.Signal, grace time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		if svr.TLSConfig != nil {
+			errc <- svr.ServeTLS(ln, "", "")
+		} else {
+			errc <- svr.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-stop:
+		infof("Received %v, draining %v requests in flight", sig, atomic.LoadInt64(&inFlight))
+		status.drain()
+		ctx, cancel := context.WithTimeout(context.Background(), grace)
+		defer cancel()
+		if err := svr.Shutdown(ctx); err != nil {
+			return fmt.Errorf("could not drain requests in flight within %v: %v", grace, err)
+		}
+		<-errc
+		infof("Stopped serving")
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockingHandler returns a handler that signals entered and waits for
+// release before it answers with status 200.
+func blockingHandler(entered, release chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// TestLimitRequest tests that requests above the concurrency limit are shed
+// and oversized bodies are rejected.
+func TestLimitRequest(t *testing.T) {
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Server.MaxInFlight = 1
+	c.Server.MaxBodyBytes = 16
+	setConfig(c)
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(limitRequest(verbFilter, blockingHandler(entered, release)))
+	defer srv.Close()
+
+	first := make(chan int)
+	go func() {
+		res, err := http.Post(srv.URL, "application/json", bytes.NewBufferString("{}"))
+		if err != nil {
+			first <- 0
+			return
+		}
+		res.Body.Close()
+		first <- res.StatusCode
+	}()
+	<-entered
+
+	shedBefore := counterValue(t, requestsTotal.WithLabelValues(verbFilter, outcomeShed))
+	res, err := http.Post(srv.URL, "application/json", bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %v above the limit but got %v", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header on a shed request")
+	}
+	if shed := counterValue(t, requestsTotal.WithLabelValues(verbFilter, outcomeShed)); shed != shedBefore+1 {
+		t.Errorf("Expected the shed request to be counted, got %v shed requests", shed-shedBefore)
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("Expected status %v for the request in flight but got %v", http.StatusOK, code)
+	}
+
+	res, err = http.Post(srv.URL, "application/json", bytes.NewBufferString(`{"nodes": {"items": []}}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %v for an oversized body but got %v", http.StatusRequestEntityTooLarge, res.StatusCode)
+	}
+}
+
+// TestLimitRequestChunked tests that a body without content length is cut
+// off at the limit and rejected as too large.
+func TestLimitRequestChunked(t *testing.T) {
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.Server.MaxBodyBytes = 16
+	setConfig(c)
+
+	srv := httptest.NewServer(limitRequest(verbFilter, handler))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL, ioutil.NopCloser(bytes.NewBufferString(`{"nodes": {"items": []}}`)))
+	req.ContentLength = -1
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %v for an oversized chunked body but got %v", http.StatusRequestEntityTooLarge, res.StatusCode)
+	}
+}
+
+// TestServeDrains tests that a signal stops the server after the requests in
+// flight are answered.
+func TestServeDrains(t *testing.T) {
+	defer func(s *heatStatus) { status = s }(status)
+	status = &heatStatus{}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	entered, release := make(chan struct{}), make(chan struct{})
+	svr := newServer(defaultConfig(), blockingHandler(entered, release))
+	stop := make(chan os.Signal, 1)
+	done := make(chan error)
+	go func() { done <- serve(svr, ln, stop, 5*time.Second) }()
+
+	first := make(chan int)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			first <- 0
+			return
+		}
+		res.Body.Close()
+		first <- res.StatusCode
+	}()
+	<-entered
+
+	stop <- syscall.SIGTERM
+	for i := 0; i < 100; i++ {
+		if ready, _ := status.ready(defaultConfig()); !ready {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ready, _ := status.ready(defaultConfig()); ready {
+		t.Errorf("Expected not to be ready while draining")
+	}
+
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("Expected status %v for the request in flight but got %v", http.StatusOK, code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected serve to return after draining")
+	}
+}
+
+// TestServeFails tests that serve returns an error when it can not serve.
+func TestServeFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ln.Close()
+	if err := serve(newServer(defaultConfig(), newMux()), ln, nil, time.Second); err == nil {
+		t.Errorf("Expected an error serving on a closed listener")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// defaultUpdatedAtKey is the key of the label, or annotation, in which the
+	// monitor records when it wrote the joules of a node.
+	defaultUpdatedAtKey = "joules-updated-at"
+
+	// staleUnknown treats stale heat as missing, so the missing heat policy
+	// decides what happens to the node.
+	staleUnknown = "unknown"
+	// staleDownweight keeps stale heat but adds a penalty to it, so nodes
+	// with fresh heat are preferred.
+	staleDownweight = "downweight"
+)
+
+// errStale is returned for a node whose heat is older than the max age.
+var errStale = errors.New("heat is stale")
+
+// stalenessPolicy decides when heat is too old to trust.
+type stalenessPolicy struct {
+	UpdatedAtKey string   `json:"updatedAtKey"` // label or annotation holding the time the heat was written
+	MaxAge       duration `json:"maxAge"`       // heat older than this is stale, 0 disables the check
+	Action       string   `json:"action"`       // unknown or downweight
+	Penalty      float64  `json:"penalty"`      // joules added to stale heat by downweight
+}
+
+// validate returns an error describing the first invalid setting of p.
+func (p *stalenessPolicy) validate() error {
+	if p.MaxAge.Duration < 0 {
+		return fmt.Errorf("max age must not be negative, got %v", p.MaxAge)
+	}
+	if p.UpdatedAtKey == "" {
+		return fmt.Errorf("updated at key must not be empty")
+	}
+	switch p.Action {
+	case staleUnknown:
+	case staleDownweight:
+		if p.Penalty <= 0 {
+			return fmt.Errorf("penalty must be positive with action %v, got %v", p.Action, p.Penalty)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", p.Action)
+	}
+	return nil
+}
+
+// parseUpdatedAt parses the time heat was written, either unix seconds as
+// written by the monitor into a label or RFC 3339 as allowed in annotations.
+func parseUpdatedAt(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// staleSource wraps a heat source and applies the staleness policy to its
+// readings. Readings without a time are stale, their age can not be told.
+type staleSource struct {
+	HeatSource
+	policy stalenessPolicy
+	now    func() time.Time
+}
+
+// Heat returns the reading of the wrapped source, errStale or a penalized
+// reading when it is older than the max age.
+func (s staleSource) Heat(node *k8sApi.Node) (heatReading, error) {
+	r, err := s.HeatSource.Heat(node)
+	if err != nil {
+		return r, err
+	}
+	if !r.Updated.IsZero() && s.now().Sub(r.Updated) <= s.policy.MaxAge.Duration {
+		return r, nil
+	}
+	if s.policy.Action == staleUnknown {
+		return heatReading{}, errStale
+	}
+	r.Joules += s.policy.Penalty
+	r.Stale = true
+	return r, nil
+}
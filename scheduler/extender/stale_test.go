@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// newTimedNode returns a node with a joules label written at updated.
+func newTimedNode(name, joules string, updated time.Time) k8sApi.Node {
+	node := newNode(name, joules)
+	node.Labels[defaultUpdatedAtKey] = strconv.FormatInt(updated.Unix(), 10)
+	return node
+}
+
+// TestStaleSource tests that heat older than the max age is treated as
+// unknown or down-weighted.
+func TestStaleSource(t *testing.T) {
+	now := time.Date(2016, 6, 3, 15, 0, 0, 0, time.UTC)
+	annotated := newNode("node1", "")
+	annotated.Annotations = map[string]string{
+		defaultHeatAnnotationKey: "40",
+		defaultUpdatedAtKey:      "2016-06-03T14:59:00Z",
+	}
+	label := labelSource{key: defaultLabelKey, updatedAtKey: defaultUpdatedAtKey}
+
+	testCases := map[string]struct {
+		source   HeatSource
+		action   string
+		node     k8sApi.Node
+		expected float64
+		stale    bool
+		err      error
+	}{
+		"fresh":                {label, staleUnknown, newTimedNode("node1", "50", now.Add(-time.Minute)), 50, false, nil},
+		"stale unknown":        {label, staleUnknown, newTimedNode("node1", "50", now.Add(-time.Hour)), 0, false, errStale},
+		"stale downweight":     {label, staleDownweight, newTimedNode("node1", "50", now.Add(-time.Hour)), 150, true, nil},
+		"without time":         {label, staleUnknown, newNode("node1", "50"), 0, false, errStale},
+		"missing":              {label, staleUnknown, newNode("node1", ""), 0, false, errNoHeat},
+		"fresh annotation":     {annotationSource{key: defaultHeatAnnotationKey, updatedAtKey: defaultUpdatedAtKey}, staleUnknown, annotated, 40, false, nil},
+		"invalid time is old":  {label, staleDownweight, func() k8sApi.Node { n := newNode("node1", "50"); n.Labels[defaultUpdatedAtKey] = "soon"; return n }(), 150, true, nil},
+		"exactly max age":      {label, staleUnknown, newTimedNode("node1", "50", now.Add(-10*time.Minute)), 50, false, nil},
+		"stale downweight new": {label, staleDownweight, newTimedNode("node1", "50", now), 50, false, nil},
+	}
+
+	for desc, tc := range testCases {
+		s := staleSource{
+			HeatSource: tc.source,
+			policy:     stalenessPolicy{MaxAge: duration{10 * time.Minute}, Action: tc.action, Penalty: 100},
+			now:        fakeClock(&now),
+		}
+		r, err := s.Heat(&tc.node)
+		if err != tc.err {
+			t.Errorf("Test case %v: expected error %v but got %v", desc, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if r.Joules != tc.expected || r.Stale != tc.stale {
+			t.Errorf("Test case %v: expected %v joules (stale=%v) but got %v (stale=%v)", desc, tc.expected, tc.stale, r.Joules, r.Stale)
+		}
+	}
+}
+
+// TestStaleFilter tests that stale heat goes through the missing heat policy
+// and that stale nodes are counted.
+func TestStaleFilter(t *testing.T) {
+	now := time.Now()
+	c := defaultConfig()
+	c.Staleness.MaxAge = duration{10 * time.Minute}
+	c.Missing.Policy = missingClosed
+	c.Filter = filterPolicy{Mode: filterModeCeiling, MaxJoules: 1000}
+	c.source = newHeatSource(c)
+
+	list := newNodeList(
+		newTimedNode("node1", "50", now.Add(-time.Hour)),
+		newTimedNode("node2", "60", now),
+	)
+	pod := newPod("pod", nil)
+	nodes, failed, err := filterForPod(c, &pod, readCandidates(c, list.Items))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "node2" || failed["node1"] == "" {
+		t.Errorf("Expected only the fresh node2 to pass but got %v nodes and failed %v", len(nodes), failed)
+	}
+
+	observeNodes(c, verbFilter, readCandidates(c, list.Items))
+	if n := gaugeValue(t, staleNodes.WithLabelValues(verbFilter)); n != 1 {
+		t.Errorf("Expected 1 stale node but got %v", n)
+	}
+}
+
+// TestSwitchStaleSource tests that a changed staleness policy keeps the
+// wrapped http source.
+func TestSwitchStaleSource(t *testing.T) {
+	inner := newHTTPSource("http://127.0.0.1:1", time.Hour, time.Second)
+	old := staleSource{HeatSource: inner, policy: stalenessPolicy{MaxAge: duration{time.Minute}}}
+	updated := staleSource{HeatSource: newHTTPSource("http://127.0.0.1:1", time.Hour, time.Second), policy: stalenessPolicy{MaxAge: duration{time.Hour}}}
+
+	s, ok := switchSource(old, updated).(staleSource)
+	if !ok {
+		t.Fatalf("Expected the staleness policy to stay active")
+	}
+	if s.HeatSource != inner || s.policy.MaxAge.Duration != time.Hour {
+		t.Errorf("Expected the wrapped source to be kept with the new policy")
+	}
+}
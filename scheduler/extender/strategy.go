@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	strategyCoolest        = "coolest"
+	strategyWeightedRandom = "weighted-random"
+	strategyPowerOfTwo     = "power-of-two"
+	strategyRoundRobin     = "round-robin"
+)
+
+// Strategy picks the node to schedule a pod on out of a list of candidates.
+type Strategy interface {
+	// Name returns the name used to pick the strategy on the command line.
+	Name() string
+	// Select returns the index of the chosen node. joules holds the joules
+	// of the node at the same index, or the max float value if unknown.
+	// nodes always holds at least one node.
+	Select(nodes []k8sApi.Node, joules []float64) int
+	// Chances returns for every node the chance that the next call to Select
+	// with the same joules picks it, without changing the strategy.
+	Chances(joules []float64) []float64
+}
+
+// newStrategy returns the strategy with the given name. k is the number of
+// nodes round robin cycles through and seed seeds the random strategies.
+func newStrategy(name string, k int, seed int64) (Strategy, error) {
+	switch name {
+	case strategyCoolest:
+		return coolestStrategy{}, nil
+	case strategyWeightedRandom:
+		return &weightedRandomStrategy{rand: rand.New(rand.NewSource(seed))}, nil
+	case strategyPowerOfTwo:
+		return &powerOfTwoStrategy{rand: rand.New(rand.NewSource(seed))}, nil
+	case strategyRoundRobin:
+		if k < 1 {
+			return nil, fmt.Errorf("round robin needs at least 1 node, got %v", k)
+		}
+		return &roundRobinStrategy{k: k}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", name)
+}
+
+// coolestStrategy picks the node with the lowest joules, the first node
+// breaks ties.
+type coolestStrategy struct{}
+
+func (coolestStrategy) Name() string { return strategyCoolest }
+
+func (coolestStrategy) Select(nodes []k8sApi.Node, joules []float64) int {
+	best := 0
+	for i := 1; i < len(joules); i++ {
+		if joules[i] < joules[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func (s coolestStrategy) Chances(joules []float64) []float64 {
+	chances := make([]float64, len(joules))
+	chances[s.Select(nil, joules)] = 1
+	return chances
+}
+
+// weightedRandomStrategy picks a random node where the chance of a node being
+// picked is inversely proportional to its joules. Nodes with unknown joules
+// are only picked if no node has known joules.
+type weightedRandomStrategy struct {
+	mu   sync.Mutex // guards rand
+	rand *rand.Rand
+}
+
+func (s *weightedRandomStrategy) Name() string { return strategyWeightedRandom }
+
+func (s *weightedRandomStrategy) Select(nodes []k8sApi.Node, joules []float64) int {
+	weights, total := inverseWeights(joules)
+	if total == 0 {
+		return coolestStrategy{}.Select(nodes, joules)
+	}
+
+	s.mu.Lock()
+	pick := s.rand.Float64() * total
+	s.mu.Unlock()
+	for i, w := range weights {
+		if pick < w {
+			return i
+		}
+		pick -= w
+	}
+	// rounding errors can leave a tiny remainder, fall back to the last
+	// node with a weight
+	for i := len(weights) - 1; i > 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func (s *weightedRandomStrategy) Chances(joules []float64) []float64 {
+	weights, total := inverseWeights(joules)
+	if total == 0 {
+		return coolestStrategy{}.Chances(joules)
+	}
+	for i := range weights {
+		weights[i] /= total
+	}
+	return weights
+}
+
+// inverseWeights returns a weight inversely proportional to the joules of
+// every node and the sum of all weights. Nodes with unknown joules weigh 0.
+func inverseWeights(joules []float64) ([]float64, float64) {
+	weights := make([]float64, len(joules))
+	total := 0.0
+	for i, j := range joules {
+		if j == math.MaxFloat64 {
+			continue
+		}
+		// nodes at or below zero joules are as cool as it gets
+		weights[i] = 1 / math.Max(j, 1e-9)
+		total += weights[i]
+	}
+	return weights, total
+}
+
+// withHeat returns the indexes of the nodes with known joules, or of every
+// node when no node has known joules. Strategies only fall back to nodes with
+// unknown joules when there is nothing else to pick.
+func withHeat(joules []float64) []int {
+	known := make([]int, 0, len(joules))
+	for i, j := range joules {
+		if j != math.MaxFloat64 {
+			known = append(known, i)
+		}
+	}
+	if len(known) == 0 {
+		for i := range joules {
+			known = append(known, i)
+		}
+	}
+	return known
+}
+
+// powerOfTwoStrategy picks two distinct nodes at random and returns the cooler
+// of the two. Both nodes are drawn from the nodes with known joules.
+type powerOfTwoStrategy struct {
+	mu   sync.Mutex // guards rand
+	rand *rand.Rand
+}
+
+func (s *powerOfTwoStrategy) Name() string { return strategyPowerOfTwo }
+
+func (s *powerOfTwoStrategy) Select(nodes []k8sApi.Node, joules []float64) int {
+	known := withHeat(joules)
+	if len(known) == 1 {
+		return known[0]
+	}
+	s.mu.Lock()
+	a := s.rand.Intn(len(known))
+	b := s.rand.Intn(len(known) - 1)
+	s.mu.Unlock()
+	if b >= a {
+		b++
+	}
+	return cooler(joules, known[a], known[b])
+}
+
+func (s *powerOfTwoStrategy) Chances(joules []float64) []float64 {
+	chances := make([]float64, len(joules))
+	known := withHeat(joules)
+	n := len(known)
+	if n == 1 {
+		chances[known[0]] = 1
+		return chances
+	}
+	// every unordered pair of distinct nodes is equally likely
+	pair := 2 / float64(n*(n-1))
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			chances[cooler(joules, known[a], known[b])] += pair
+		}
+	}
+	return chances
+}
+
+// cooler returns the index of the cooler of two nodes, the lower index breaks
+// ties.
+func cooler(joules []float64, a, b int) int {
+	if joules[b] < joules[a] || (joules[b] == joules[a] && b < a) {
+		return b
+	}
+	return a
+}
+
+// roundRobinStrategy cycles through the k coolest nodes, nodes with unknown
+// joules are only part of the cycle when no node has known joules.
+type roundRobinStrategy struct {
+	k    int
+	mu   sync.Mutex // guards next
+	next int
+}
+
+func (s *roundRobinStrategy) Name() string { return strategyRoundRobin }
+
+func (s *roundRobinStrategy) Select(nodes []k8sApi.Node, joules []float64) int {
+	order := coolestFirst(joules)
+	k := s.k
+	if n := len(withHeat(joules)); k > n {
+		k = n
+	}
+
+	s.mu.Lock()
+	pick := s.next % k
+	s.next++
+	s.mu.Unlock()
+	return order[pick]
+}
+
+func (s *roundRobinStrategy) Chances(joules []float64) []float64 {
+	order := coolestFirst(joules)
+	k := s.k
+	if n := len(withHeat(joules)); k > n {
+		k = n
+	}
+
+	s.mu.Lock()
+	pick := s.next % k
+	s.mu.Unlock()
+	chances := make([]float64, len(joules))
+	chances[order[pick]] = 1
+	return chances
+}
+
+// byJoules sorts node indexes by the joules of the nodes they point to.
+type byJoules struct {
+	order  []int
+	joules []float64
+}
+
+func (b byJoules) Len() int           { return len(b.order) }
+func (b byJoules) Less(i, j int) bool { return b.joules[b.order[i]] < b.joules[b.order[j]] }
+func (b byJoules) Swap(i, j int)      { b.order[i], b.order[j] = b.order[j], b.order[i] }
+
+// coolestFirst returns the indexes of joules ordered from cool to warm, equal
+// joules keep their original order.
+func coolestFirst(joules []float64) []int {
+	order := make([]int, len(joules))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Stable(byJoules{order: order, joules: joules})
+	return order
+}
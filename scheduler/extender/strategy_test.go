@@ -0,0 +1,234 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// strategyNodes returns nodes named after their index with the given joules.
+func strategyNodes(joules ...float64) []k8sApi.Node {
+	nodes := make([]k8sApi.Node, len(joules))
+	for i := range joules {
+		nodes[i] = newNode(string('a'+rune(i)), "")
+	}
+	return nodes
+}
+
+// pickCounts lets a strategy pick n times and counts how often each node was
+// picked.
+func pickCounts(s Strategy, joules []float64, n int) []int {
+	nodes := strategyNodes(joules...)
+	counts := make([]int, len(joules))
+	for i := 0; i < n; i++ {
+		counts[s.Select(nodes, joules)]++
+	}
+	return counts
+}
+
+// TestCoolestStrategy tests that the coolest node is picked and the first node
+// breaks ties.
+func TestCoolestStrategy(t *testing.T) {
+	testCases := map[string]struct {
+		joules   []float64
+		expected int
+	}{
+		"sorted":    {[]float64{50, 60, 70}, 0},
+		"reverse":   {[]float64{70, 60, 50}, 2},
+		"tie":       {[]float64{60, 50, 50}, 1},
+		"unknown":   {[]float64{math.MaxFloat64, 60}, 1},
+		"all equal": {[]float64{math.MaxFloat64, math.MaxFloat64}, 0},
+	}
+
+	for desc, tc := range testCases {
+		if i := (coolestStrategy{}).Select(strategyNodes(tc.joules...), tc.joules); i != tc.expected {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, i)
+		}
+	}
+}
+
+// TestWeightedRandomStrategy tests that nodes are picked in inverse proportion
+// to their joules and that equal seeds give equal picks.
+func TestWeightedRandomStrategy(t *testing.T) {
+	joules := []float64{10, 20, 40, math.MaxFloat64}
+	s, _ := newStrategy(strategyWeightedRandom, 0, 42)
+	counts := pickCounts(s, joules, 7000)
+
+	// weights are 1/10, 1/20 and 1/40, so expect a 4:2:1 ratio
+	expected := []float64{4000, 2000, 1000, 0}
+	for i := range counts {
+		if math.Abs(float64(counts[i])-expected[i]) > expected[i]*0.1 {
+			t.Errorf("Node %v: expected about %v picks but got %v", i, expected[i], counts[i])
+		}
+	}
+
+	same, _ := newStrategy(strategyWeightedRandom, 0, 42)
+	if again := pickCounts(same, joules, 7000); !equalInts(counts, again) {
+		t.Errorf("Expected equal seeds to give equal picks, got %v and %v", counts, again)
+	}
+}
+
+// TestPowerOfTwoStrategy tests that the warmest node is never picked and that
+// equal seeds give equal picks.
+func TestPowerOfTwoStrategy(t *testing.T) {
+	joules := []float64{10, 20, 30, 40}
+	s, _ := newStrategy(strategyPowerOfTwo, 0, 7)
+	counts := pickCounts(s, joules, 6000)
+
+	// the coolest node wins every pair it is in: 3 out of 6 pairs
+	if math.Abs(float64(counts[0])-3000) > 300 {
+		t.Errorf("Expected about 3000 picks of the coolest node but got %v", counts[0])
+	}
+	if counts[3] != 0 {
+		t.Errorf("Expected the warmest node never to be picked but got %v", counts[3])
+	}
+
+	same, _ := newStrategy(strategyPowerOfTwo, 0, 7)
+	if again := pickCounts(same, joules, 6000); !equalInts(counts, again) {
+		t.Errorf("Expected equal seeds to give equal picks, got %v and %v", counts, again)
+	}
+
+	single := []float64{10}
+	if i := s.Select(strategyNodes(single...), single); i != 0 {
+		t.Errorf("Expected the only node to be picked but got %v", i)
+	}
+}
+
+// TestRoundRobinStrategy tests that round robin cycles through the k coolest
+// nodes.
+func TestRoundRobinStrategy(t *testing.T) {
+	joules := []float64{40, 10, 30, 20}
+	s, err := newStrategy(strategyRoundRobin, 3, 0)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+	nodes := strategyNodes(joules...)
+	expected := []int{1, 3, 2, 1, 3, 2}
+	for n, e := range expected {
+		if i := s.Select(nodes, joules); i != e {
+			t.Errorf("Pick %v: expected %v but got %v", n, e, i)
+		}
+	}
+
+	if _, err := newStrategy(strategyRoundRobin, 0, 0); err == nil {
+		t.Errorf("Expected error for k=0")
+	}
+	if _, err := newStrategy("hottest", 0, 0); err == nil {
+		t.Errorf("Expected error for unknown strategy")
+	}
+}
+
+// TestStrategyUnknown tests that the random and cycling strategies never pick
+// nodes with unknown joules while a node has known joules, and fall back to
+// them otherwise.
+func TestStrategyUnknown(t *testing.T) {
+	unknown := math.MaxFloat64
+	testCases := map[string]struct {
+		strategy string
+		joules   []float64
+		allowed  []bool
+	}{
+		"round robin":          {strategyRoundRobin, []float64{1, 2, unknown, 3}, []bool{true, true, false, true}},
+		"round robin none":     {strategyRoundRobin, []float64{unknown, unknown}, []bool{true, true}},
+		"power of two":         {strategyPowerOfTwo, []float64{1, unknown, unknown}, []bool{true, false, false}},
+		"power of two two":     {strategyPowerOfTwo, []float64{unknown, 2, unknown, 1}, []bool{false, true, false, true}},
+		"power of two none":    {strategyPowerOfTwo, []float64{unknown, unknown}, []bool{true, true}},
+		"weighted random none": {strategyWeightedRandom, []float64{unknown, unknown}, []bool{true, false}},
+	}
+
+	for desc, tc := range testCases {
+		s, _ := newStrategy(tc.strategy, 4, 5)
+		counts := pickCounts(s, tc.joules, 300)
+		for i, n := range counts {
+			if n > 0 && !tc.allowed[i] {
+				t.Errorf("Test case %v: expected node %v never to be picked but got %v picks", desc, i, n)
+			}
+		}
+		chances := s.Chances(tc.joules)
+		for i, chance := range chances {
+			if chance > 0 && !tc.allowed[i] {
+				t.Errorf("Test case %v: expected node %v to have no chance but got %v", desc, i, chance)
+			}
+		}
+	}
+}
+
+// TestStrategySpread compares how evenly each strategy spreads heat when every
+// placement heats the chosen node. The spread is logged, run with -v to
+// compare the strategies.
+func TestStrategySpread(t *testing.T) {
+	const (
+		placements = 200
+		heat       = 1.0
+	)
+	strategies := []string{strategyCoolest, strategyWeightedRandom, strategyPowerOfTwo, strategyRoundRobin}
+	for _, name := range strategies {
+		s, _ := newStrategy(name, 3, 1)
+		joules := []float64{50, 52, 55, 60, 70} // initial spread of 20
+		nodes := strategyNodes(joules...)
+		for i := 0; i < placements; i++ {
+			joules[s.Select(nodes, joules)] += heat
+		}
+
+		min, max := math.MaxFloat64, -math.MaxFloat64
+		for _, j := range joules {
+			min = math.Min(min, j)
+			max = math.Max(max, j)
+		}
+		t.Logf("%-16v spread %6.2f joules %v", name, max-min, joules)
+		if max-min >= 20 {
+			t.Errorf("Strategy %v: expected the spread to shrink below 20 but got %v", name, max-min)
+		}
+	}
+}
+
+// equalInts returns whether two int slices are equal.
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestStrategyChances tests that the chances of every strategy add up to one
+// and match the picks the strategy makes.
+func TestStrategyChances(t *testing.T) {
+	joules := []float64{10, 20, 40, math.MaxFloat64}
+	testCases := map[string]struct {
+		strategy string
+		expected []float64
+	}{
+		"coolest":         {strategyCoolest, []float64{1, 0, 0, 0}},
+		"weighted random": {strategyWeightedRandom, []float64{4.0 / 7, 2.0 / 7, 1.0 / 7, 0}},
+		"power of two":    {strategyPowerOfTwo, []float64{2.0 / 3, 1.0 / 3, 0, 0}},
+		"round robin":     {strategyRoundRobin, []float64{1, 0, 0, 0}},
+	}
+
+	for desc, tc := range testCases {
+		s, _ := newStrategy(tc.strategy, 2, 3)
+		chances := s.Chances(joules)
+		for i := range chances {
+			if math.Abs(chances[i]-tc.expected[i]) > 1e-9 {
+				t.Errorf("Test case %v: expected chances %v but got %v", desc, tc.expected, chances)
+				break
+			}
+		}
+	}
+
+	// chances of round robin follow its picks without advancing it
+	s, _ := newStrategy(strategyRoundRobin, 2, 0)
+	nodes := strategyNodes(joules...)
+	for n := 0; n < 4; n++ {
+		chances := s.Chances(joules)
+		if pick := s.Select(nodes, joules); chances[pick] != 1 {
+			t.Errorf("Pick %v: expected chance 1 for picked node %v but got %v", n, pick, chances)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package main
 
-import k8sApi "k8s.io/kubernetes/pkg/api"
+import (
+	"fmt"
+	"strconv"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sResource "k8s.io/kubernetes/pkg/api/resource"
+)
 
 // this file contains functions that are shared among both test files.
 
@@ -8,7 +14,7 @@ import k8sApi "k8s.io/kubernetes/pkg/api"
 func newNode(name string, joules string) k8sApi.Node {
 	jmap := make(map[string]string)
 	if joules != "" {
-		jmap["joules"] = joules
+		jmap[defaultLabelKey] = joules
 	}
 	return k8sApi.Node{
 		ObjectMeta: k8sApi.ObjectMeta{
@@ -24,3 +30,63 @@ func newNodeList(nodes ...k8sApi.Node) k8sApi.NodeList {
 		Items: nodes,
 	}
 }
+
+// newPod returns a new k8sApi.Pod given a name, annotations and the cpu
+// requested by each of its containers.
+func newPod(name string, annotations map[string]string, cpus ...string) k8sApi.Pod {
+	containers := []k8sApi.Container{}
+	for _, cpu := range cpus {
+		containers = append(containers, k8sApi.Container{
+			Resources: k8sApi.ResourceRequirements{
+				Requests: k8sApi.ResourceList{
+					k8sApi.ResourceCPU: k8sResource.MustParse(cpu),
+				},
+			},
+		})
+	}
+	return k8sApi.Pod{
+		ObjectMeta: k8sApi.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Annotations: annotations,
+		},
+		Spec: k8sApi.PodSpec{
+			Containers: containers,
+		},
+	}
+}
+
+// newSizedNode returns a node with joules and allocatable cpu and memory.
+func newSizedNode(name, joules, cpu, memory string) k8sApi.Node {
+	node := newNode(name, joules)
+	node.Status.Allocatable = k8sApi.ResourceList{
+		k8sApi.ResourceCPU:    k8sResource.MustParse(cpu),
+		k8sApi.ResourceMemory: k8sResource.MustParse(memory),
+	}
+	return node
+}
+
+// newBoundPod returns a pod requesting cpus that is bound to a node.
+func newBoundPod(name, node string, cpus ...string) k8sApi.Pod {
+	pod := newPod(name, nil, cpus...)
+	pod.Spec.NodeName = node
+	return pod
+}
+
+// newCluster returns n nodes with distinct joules, resource versions and the
+// labels and resources of a typical cluster node, as sent by the kubernetes
+// scheduler.
+func newCluster(n int) k8sApi.NodeList {
+	list := k8sApi.NodeList{Items: make([]k8sApi.Node, n)}
+	for i := range list.Items {
+		node := newSizedNode(fmt.Sprintf("node%05d", i), fmt.Sprintf("%v.%03d", 1000+i*7%n, i%1000), "16", "64Gi")
+		node.ResourceVersion = strconv.Itoa(i + 1)
+		node.Labels["kubernetes.io/hostname"] = node.Name
+		node.Labels["beta.kubernetes.io/arch"] = "amd64"
+		node.Labels["beta.kubernetes.io/os"] = "linux"
+		node.Labels[defaultUpdatedAtKey] = "1465300000"
+		node.Status.Capacity = node.Status.Allocatable
+		list.Items[i] = node
+	}
+	return list
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// certCheckInterval is how often the tls files are checked for changes.
+	certCheckInterval = 10 * time.Second
+)
+
+// certReloader serves the certificate and client CAs from the tls files and
+// reloads them when the files change on disk, so rotated certificates are
+// picked up without a restart.
+type certReloader struct {
+	files tlsFiles
+
+	mu       sync.Mutex // guards the fields below
+	config   *tls.Config
+	modTimes []time.Time // modification times of the files the config was loaded from
+	checked  time.Time   // last time the files were checked for changes
+	now      func() time.Time
+}
+
+// newCertReloader returns a reloader serving the given tls files. It returns
+// an error if the files can not be loaded.
+func newCertReloader(files tlsFiles) (*certReloader, error) {
+	r := &certReloader{files: files, now: time.Now}
+	config, modTimes, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.config, r.modTimes, r.checked = config, modTimes, r.now()
+	return r, nil
+}
+
+// tlsConfig returns the config to serve HTTPS with. Every handshake uses the
+// most recently loaded files.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// current returns the config loaded from the tls files, reloading them first
+// if they changed since the last check. A failed reload is logged and the
+// previous config is kept.
+func (r *certReloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.checked) < certCheckInterval {
+		return r.config
+	}
+	r.checked = now
+
+	modTimes, err := r.stat()
+	if err != nil {
+		errorf("Could not check tls files, keeping current certificate: %v", err)
+		return r.config
+	}
+	if equalTimes(modTimes, r.modTimes) {
+		return r.config
+	}
+
+	config, modTimes, err := r.load()
+	if err != nil {
+		errorf("Could not reload tls files, keeping current certificate: %v", err)
+		return r.config
+	}
+	r.config, r.modTimes = config, modTimes
+	infof("Reloaded tls certificate from %v", r.files.CertFile)
+	return r.config
+}
+
+// load reads the tls files and returns the config they describe together with
+// their modification times.
+func (r *certReloader) load() (*tls.Config, []time.Time, error) {
+	// stat before reading so a change during the read is seen next check.
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load tls key pair: %v", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if r.files.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("client CA file %v holds no PEM certificates", r.files.ClientCAFile)
+		}
+		// health probes can not present a certificate, requireClientCert
+		// rejects unverified clients on the scheduler verbs.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = pool
+	}
+	return config, modTimes, nil
+}
+
+// stat returns the modification times of the tls files.
+func (r *certReloader) stat() ([]time.Time, error) {
+	modTimes := []time.Time{}
+	for _, f := range []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// equalTimes returns whether two lists of times are equal.
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// requireClientCert wraps a handler so it rejects requests without a verified
+// client certificate with status 403 when a client CA is configured.
+func requireClientCert(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentConfig().TLS.ClientCAFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "a client certificate signed by the client CA is required", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA signs certificates for the tls tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCA returns a self-signed CA.
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "heat-scheduler"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes content to a file in dir and returns its path.
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("Error writing %v: %v", name, err)
+	}
+	return path
+}
+
+// TestCertReloader tests that the served certificate is reloaded when the
+// files change and kept when the new files are invalid.
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extender-tls")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	files := tlsFiles{
+		CertFile: writeFile(t, dir, "tls.crt", certPEM),
+		KeyFile:  writeFile(t, dir, "tls.key", keyPEM),
+	}
+	r, err := newCertReloader(files)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Now()
+	r.now = fakeClock(&now)
+
+	serial := func() int64 {
+		leaf, err := x509.ParseCertificate(r.current().Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("Error parsing served certificate: %v", err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if s := serial(); s != 2 {
+		t.Errorf("Expected serial 2 but got %v", s)
+	}
+
+	// rotate the certificate
+	certPEM, keyPEM = ca.issue(t, 3, x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "tls.crt", certPEM)
+	writeFile(t, dir, "tls.key", keyPEM)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(files.CertFile, later, later)
+	os.Chtimes(files.KeyFile, later, later)
+
+	if s := serial(); s != 2 {
+		t.Errorf("Expected serial 2 before the check interval passed but got %v", s)
+	}
+	now = now.Add(certCheckInterval)
+	if s := serial(); s != 3 {
+		t.Errorf("Expected serial 3 after rotation but got %v", s)
+	}
+
+	// a broken certificate keeps the current one
+	writeFile(t, dir, "tls.crt", []byte("not a certificate"))
+	later = later.Add(time.Minute)
+	os.Chtimes(files.CertFile, later, later)
+	now = now.Add(certCheckInterval)
+	if s := serial(); s != 3 {
+		t.Errorf("Expected serial 3 after a broken rotation but got %v", s)
+	}
+
+	if _, err := newCertReloader(tlsFiles{CertFile: files.CertFile, KeyFile: files.KeyFile}); err == nil {
+		t.Errorf("Expected error loading a broken certificate")
+	}
+}
+
+// TestClientCertVerification tests that the scheduler verbs require a client
+// certificate signed by the client CA and the health endpoints do not.
+func TestClientCertVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extender-tls")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	files := tlsFiles{
+		CertFile:     writeFile(t, dir, "tls.crt", serverCert),
+		KeyFile:      writeFile(t, dir, "tls.key", serverKey),
+		ClientCAFile: writeFile(t, dir, "ca.crt", ca.pem),
+	}
+	r, err := newCertReloader(files)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer setConfig(currentConfig())
+	c := defaultConfig()
+	c.TLS = files
+	setConfig(c)
+
+	srv := httptest.NewUnstartedServer(newMux())
+	srv.TLS = r.tlsConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, clientKey := ca.issue(t, 4, x509.ExtKeyUsageClientAuth)
+	pair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Error loading client key pair: %v", err)
+	}
+	other := newTestCA(t)
+	otherCert, otherKey := other.issue(t, 5, x509.ExtKeyUsageClientAuth)
+	otherPair, err := tls.X509KeyPair(otherCert, otherKey)
+	if err != nil {
+		t.Fatalf("Error loading client key pair: %v", err)
+	}
+
+	body := marshalArgs(t, newNodeList(newNode("node1", "50")))
+	testCases := map[string]struct {
+		certs    []tls.Certificate
+		method   string
+		path     string
+		expected int // 0 means the handshake fails
+	}{
+		"filter with client cert":    {[]tls.Certificate{pair}, "POST", "/filter", http.StatusOK},
+		"filter without client cert": {nil, "POST", "/filter", http.StatusForbidden},
+		"filter with other ca":       {[]tls.Certificate{otherPair}, "POST", "/filter", 0},
+		"healthz without client":     {nil, "GET", "/healthz", http.StatusOK},
+	}
+
+	for desc, tc := range testCases {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: tc.certs,
+		}}}
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, bytes.NewReader(body))
+		res, err := client.Do(req)
+		if tc.expected == 0 {
+			if err == nil {
+				res.Body.Close()
+				t.Errorf("Test case %v: expected the handshake to fail", desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.expected {
+			t.Errorf("Test case %v: expected status %v but got %v", desc, tc.expected, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	aggregateMean = "mean" // the mean joules of the nodes in a group
+	aggregateMax  = "max"  // the joules of the warmest node in a group
+	aggregateSum  = "sum"  // the total joules of the nodes in a group
+)
+
+// topologyPolicy groups nodes by a label such as a rack or zone. In coolest
+// mode the node is picked by the strategy from the group the heat class of
+// the pod prefers, the coolest group by default, instead of from all nodes.
+type topologyPolicy struct {
+	Key       string `json:"key"`       // node label naming the group of a node, empty disables grouping
+	Aggregate string `json:"aggregate"` // how the heat of a group is computed: mean, max or sum
+}
+
+// validate returns an error if the aggregate is unknown.
+func (p topologyPolicy) validate() error {
+	switch p.Aggregate {
+	case aggregateMean, aggregateMax, aggregateSum:
+		return nil
+	}
+	return fmt.Errorf("unknown aggregate %q", p.Aggregate)
+}
+
+// topologyGroup is a group of nodes sharing the value of the topology label.
+type topologyGroup struct {
+	Name   string   `json:"group"`  // value of the topology label, empty for nodes without the label
+	Joules *float64 `json:"joules"` // aggregate joules of the nodes with heat, nil if no node has heat
+	Nodes  []string `json:"nodes"`
+
+	members []int // indices of the nodes of the group
+}
+
+// byGroupJoules sorts groups from cool to warm, or from warm to cool when
+// warm is set, groups without heat last and groups of equal heat by name.
+type byGroupJoules struct {
+	groups []topologyGroup
+	warm   bool
+}
+
+func (b byGroupJoules) Len() int      { return len(b.groups) }
+func (b byGroupJoules) Swap(i, j int) { b.groups[i], b.groups[j] = b.groups[j], b.groups[i] }
+func (b byGroupJoules) Less(i, j int) bool {
+	ji, jj := b.key(i), b.key(j)
+	if ji != jj {
+		return ji < jj
+	}
+	return b.groups[i].Name < b.groups[j].Name
+}
+
+// key returns the value group i is sorted by, the max float value for a
+// group without heat.
+func (b byGroupJoules) key(i int) float64 {
+	if b.groups[i].Joules == nil {
+		return math.MaxFloat64
+	}
+	if b.warm {
+		return -*b.groups[i].Joules
+	}
+	return *b.groups[i].Joules
+}
+
+// groupNodes groups nodes by the topology label of c and aggregates the
+// joules of every group. joules holds the joules of every node. The groups
+// are returned in the order the heat class of c prefers, from cool to warm
+// or from warm to cool, nil when grouping is disabled.
+func groupNodes(c *config, nodes []k8sApi.Node, joules []float64) []topologyGroup {
+	if c.Topology.Key == "" {
+		return nil
+	}
+
+	index := make(map[string]int)
+	groups := []topologyGroup{}
+	for i, node := range nodes {
+		name := node.Labels[c.Topology.Key]
+		g, ok := index[name]
+		if !ok {
+			g = len(groups)
+			index[name] = g
+			groups = append(groups, topologyGroup{Name: name})
+		}
+		groups[g].Nodes = append(groups[g].Nodes, node.Name)
+		groups[g].members = append(groups[g].members, i)
+	}
+
+	for g := range groups {
+		n, sum, max := 0, 0.0, -math.MaxFloat64
+		for _, i := range groups[g].members {
+			if joules[i] == math.MaxFloat64 {
+				continue
+			}
+			n++
+			sum += joules[i]
+			max = math.Max(max, joules[i])
+		}
+		if n == 0 {
+			continue
+		}
+		aggregate := sum
+		switch c.Topology.Aggregate {
+		case aggregateMean:
+			aggregate = sum / float64(n)
+		case aggregateMax:
+			aggregate = max
+		}
+		groups[g].Joules = &aggregate
+	}
+
+	sort.Stable(byGroupJoules{groups, c.prefersWarm()})
+	return groups
+}
+
+// groupName returns the name of the topology group of a node.
+func groupName(c *config, node *k8sApi.Node) string {
+	return node.Labels[c.Topology.Key]
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+)
+
+// newRackNode returns a node with joules in the given rack.
+func newRackNode(name, joules, rack string) k8sApi.Node {
+	node := newNode(name, joules)
+	node.Labels["rack"] = rack
+	return node
+}
+
+// TestGroupNodes tests that nodes are grouped by the topology label and that
+// the groups are sorted by their aggregate heat.
+func TestGroupNodes(t *testing.T) {
+	list := newNodeList(
+		newRackNode("node1", "10", "a"),
+		newRackNode("node2", "50", "a"),
+		newRackNode("node3", "20", "b"),
+		newRackNode("node4", "25", "b"),
+		newRackNode("node5", "", "b"),
+		newNode("node6", "5"),
+		newRackNode("node7", "", "c"),
+	)
+
+	testCases := map[string]struct {
+		aggregate string
+		expected  []string
+		joules    []float64
+	}{
+		"mean": {aggregateMean, []string{"", "b", "a", "c"}, []float64{5, 22.5, 30}},
+		"max":  {aggregateMax, []string{"", "b", "a", "c"}, []float64{5, 25, 50}},
+		"sum":  {aggregateSum, []string{"", "b", "a", "c"}, []float64{5, 45, 60}},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		c.Topology = topologyPolicy{Key: "rack", Aggregate: tc.aggregate}
+		joules := candidateJoules(readCandidates(c, list.Items))
+		groups := groupNodes(c, list.Items, joules)
+		if len(groups) != len(tc.expected) {
+			t.Errorf("Test case %v: expected %v groups but got %v", desc, len(tc.expected), len(groups))
+			continue
+		}
+		for i, g := range groups {
+			if g.Name != tc.expected[i] {
+				t.Errorf("Test case %v: expected group %q at %v but got %q", desc, tc.expected[i], i, g.Name)
+			}
+			if i < len(tc.joules) && (g.Joules == nil || *g.Joules != tc.joules[i]) {
+				t.Errorf("Test case %v: expected group %q to have %v joules but got %v", desc, g.Name, tc.joules[i], g.Joules)
+			}
+		}
+		if last := groups[len(groups)-1]; last.Joules != nil {
+			t.Errorf("Test case %v: expected group without heat to have no joules but got %v", desc, *last.Joules)
+		}
+	}
+
+	if groups := groupNodes(defaultConfig(), list.Items, make([]float64, len(list.Items))); groups != nil {
+		t.Errorf("Expected no groups without a topology key but got %v", groups)
+	}
+}
+
+// TestTopologyFilter tests that coolest mode picks the coolest node of the
+// coolest group rather than the coolest node overall, and the warmest node of
+// the warmest group for a heat class preferring warm nodes.
+func TestTopologyFilter(t *testing.T) {
+	list := newNodeList(
+		newRackNode("node1", "10", "a"),
+		newRackNode("node2", "90", "a"),
+		newRackNode("node3", "30", "b"),
+		newRackNode("node4", "20", "b"),
+	)
+
+	testCases := map[string]struct {
+		aggregate string
+		class     string
+		expected  string
+		rejected  string
+		reason    string
+	}{
+		"no grouping": {"", classNeutral, "node1", "", ""},
+		"mean":        {aggregateMean, classNeutral, "node4", "node1", `which is warmer than group "b"`},
+		"max":         {aggregateMax, classNeutral, "node4", "node1", `which is warmer than group "b"`},
+		"warm mean":   {aggregateMean, classTolerant, "node2", "node3", `which is cooler than group "a"`},
+		"warm max":    {aggregateMax, classTolerant, "node2", "node3", `which is cooler than group "a"`},
+	}
+
+	for desc, tc := range testCases {
+		pod := newClassPod(tc.class)
+		c := defaultConfig()
+		c.HeatClasses.Classes = warmClasses(100)
+		if tc.aggregate != "" {
+			c.Topology = topologyPolicy{Key: "rack", Aggregate: tc.aggregate}
+		}
+		c = withClass(c, &pod)
+		passed, failed, err := filterNodes(c, readCandidates(c, list.Items))
+		if err != nil {
+			t.Errorf("Test case %v: unexpected error: %v", desc, err)
+			continue
+		}
+		if len(passed) != 1 || passed[0].Name != tc.expected {
+			t.Errorf("Test case %v: expected %v but got %v", desc, tc.expected, passed)
+			continue
+		}
+		if tc.rejected != "" && !strings.Contains(failed[tc.rejected], tc.reason) {
+			t.Errorf("Test case %v: expected %v to be rejected for its group but got %q", desc, tc.rejected, failed[tc.rejected])
+		}
+	}
+}
+
+// TestExplainTopology tests that the explanation holds the heat of every
+// group and that only nodes of the coolest group have a chance.
+func TestExplainTopology(t *testing.T) {
+	c := defaultConfig()
+	c.Topology = topologyPolicy{Key: "rack", Aggregate: aggregateMean}
+	pod := newPod("web", nil)
+	list := newNodeList(
+		newRackNode("node1", "10", "a"),
+		newRackNode("node2", "90", "a"),
+		newRackNode("node3", "30", "b"),
+	)
+
+	e := explainFilter(c, &pod, &list)
+	if len(e.Groups) != 2 || e.Groups[0].Name != "b" || *e.Groups[0].Joules != 30 || *e.Groups[1].Joules != 50 {
+		t.Fatalf("Expected groups b (30) and a (50) but got %+v", e.Groups)
+	}
+	for _, n := range e.Nodes {
+		expected := 0.0
+		if n.Node == "node3" {
+			expected = 1
+		}
+		if n.Chance != expected {
+			t.Errorf("Expected %v in group %v to have chance %v but got %v", n.Node, n.Group, expected, n.Chance)
+		}
+	}
+}
+
+// TestExplainTopologyWarm tests that only nodes of the warmest group have a
+// chance for a heat class preferring warm nodes.
+func TestExplainTopologyWarm(t *testing.T) {
+	c := defaultConfig()
+	c.Topology = topologyPolicy{Key: "rack", Aggregate: aggregateMean}
+	c.HeatClasses.Classes = warmClasses(100)
+	pod := newClassPod(classTolerant)
+	list := newNodeList(
+		newRackNode("node1", "10", "a"),
+		newRackNode("node2", "90", "a"),
+		newRackNode("node3", "30", "b"),
+	)
+
+	e := explainFilter(c, &pod, &list)
+	if len(e.Groups) != 2 || e.Groups[0].Name != "a" || *e.Groups[0].Joules != 50 {
+		t.Fatalf("Expected group a (50) to be preferred but got %+v", e.Groups)
+	}
+	for _, n := range e.Nodes {
+		expected := 0.0
+		if n.Node == "node2" {
+			expected = 1
+		}
+		if n.Chance != expected {
+			t.Errorf("Expected %v in group %v to have chance %v but got %v", n.Node, n.Group, expected, n.Chance)
+		}
+		if n.Verdict != verdictPass && n.Node == "node2" {
+			t.Errorf("Expected node2 to pass but got %v (%v)", n.Verdict, n.Reason)
+		}
+	}
+}
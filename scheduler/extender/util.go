@@ -3,50 +3,157 @@ package main
 import (
 	"fmt"
 	"math"
-	"strconv"
 
 	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sSchedulerApi "k8s.io/kubernetes/plugin/pkg/scheduler/api"
 )
 
-// logNodes prints a line for every node.
-func logNodes(nodes *k8sApi.NodeList) {
-	for _, n := range nodes.Items {
-		fmt.Printf("Received node %v with joules %v\n", n.Name, n.Labels["joules"])
+const (
+	// maxPriority is the highest score a node can receive from prioritizeNodes.
+	maxPriority = 10
+)
+
+// candidate is a node of a request with its heat. The heat of every node is
+// read once per request by readCandidates and passed down with the node, so
+// all steps of a request see the same values and large clusters are not
+// parsed again by every step.
+type candidate struct {
+	k8sApi.Node
+	reading heatReading // reading of the heat source, valid if err is nil
+	err     error       // why the heat source has no valid value for the node
+	penalty float64     // provisional joules of recent placements
+}
+
+// readCandidates reads the heat of every node from the heat source of c and
+// the penalty of recent placements from the ledger.
+func readCandidates(c *config, nodes []k8sApi.Node) []candidate {
+	candidates := make([]candidate, len(nodes))
+	for i := range nodes {
+		n := &candidates[i]
+		n.Node = nodes[i]
+		n.reading, n.err = c.source.Heat(&nodes[i])
+		if n.err == nil {
+			n.penalty = ledger.penaltyFor(n.Name, n.reading.Version)
+		}
 	}
+	return candidates
 }
 
-// selectNode returns the one node with the lowest joules label value out
-// of a list of nodes.
-func selectNode(nodes *k8sApi.NodeList) ([]k8sApi.Node, error) {
-	if len(nodes.Items) == 0 {
-		return nil, fmt.Errorf("No nodes were provided")
+// heat returns the joules of the heat source, or the max float value if it
+// has no valid value for the node.
+func (n *candidate) heat() float64 {
+	if n.err != nil {
+		return math.MaxFloat64
+	}
+	return n.reading.Joules
+}
+
+// joules returns the joules including the penalty of recent placements, or
+// the max float value if the heat source has no valid value for the node.
+func (n *candidate) joules() float64 {
+	if n.err != nil {
+		return math.MaxFloat64
+	}
+	return n.reading.Joules + n.penalty
+}
+
+// nodesOf returns the nodes of candidates.
+func nodesOf(candidates []candidate) []k8sApi.Node {
+	nodes := make([]k8sApi.Node, len(candidates))
+	for i := range candidates {
+		nodes[i] = candidates[i].Node
+	}
+	return nodes
+}
+
+// candidateJoules returns the joules of every candidate including the penalty
+// of recent placements, or the max float value for nodes without valid heat.
+func candidateJoules(candidates []candidate) []float64 {
+	joules := make([]float64, len(candidates))
+	for i := range candidates {
+		joules[i] = candidates[i].joules()
 	}
+	return joules
+}
 
-	// find min joules value
-	min := math.MaxFloat64
-	for _, node := range nodes.Items {
-		min = math.Min(min, jouleFromLabels(&node))
+// formatJoules formats joules for logs and reasons, nodes without valid heat
+// have unknown joules.
+func formatJoules(joules float64) string {
+	if joules == math.MaxFloat64 {
+		return "unknown"
 	}
+	return fmt.Sprint(joules)
+}
 
-	// find node belonging to min joules value
-	for _, node := range nodes.Items {
-		if min == jouleFromLabels(&node) {
-			return []k8sApi.Node{node}, nil
+// logNodes prints a line for every node.
+func logNodes(c *config, candidates []candidate) {
+	for _, n := range candidates {
+		if n.err != nil {
+			debugf("Received node %v without heat from %v: %v", n.Name, c.source.Name(), n.err)
+			continue
 		}
+		debugf("Received node %v with %v joules from %v", n.Name, n.reading.Joules, c.source.Name())
+	}
+}
+
+// pickNode returns the index of the node picked by the strategy out of
+// candidates, ranked by the values from rankValues.
+func pickNode(c *config, candidates []candidate, ranked []float64) int {
+	nodes := nodesOf(candidates)
+	groups := groupNodes(c, nodes, candidateJoules(candidates))
+	if groups == nil {
+		return c.strategy.Select(nodes, ranked)
 	}
 
-	return nil, fmt.Errorf("No suitable nodes found.")
+	// pick the node from the preferred topology group only.
+	members := groups[0].members
+	preferred := make([]k8sApi.Node, len(members))
+	values := make([]float64, len(members))
+	for i, m := range members {
+		preferred[i] = nodes[m]
+		values[i] = ranked[m]
+	}
+	return members[c.strategy.Select(preferred, values)]
 }
 
-// jouleFromLabels parses the joules from a node's label or returns
-// the max float value if the label doesn't exist.
-func jouleFromLabels(node *k8sApi.Node) float64 {
-	jouleString, exists := node.Labels["joules"]
-	if exists {
-		joule, err := strconv.ParseFloat(jouleString, 32)
-		if err == nil {
-			return joule
+// prioritizeNodes scores every node from 0 to maxPriority based on its joules,
+// blended with its headroom when c ranks by headroom. The coolest node
+// receives maxPriority, the warmest node receives 0 and nodes in between are
+// scaled linearly, the other way around when the heat class of c prefers warm
+// nodes. Nodes without valid heat receive 0.
+func prioritizeNodes(c *config, candidates []candidate) (k8sSchedulerApi.HostPriorityList, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("No nodes were provided")
+	}
+
+	// find min and max joules values among nodes with valid heat
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	joules := rankValues(c, nodesOf(candidates), rankJoules(c, candidates))
+	for i := range joules {
+		if joules[i] == math.MaxFloat64 {
+			continue
 		}
+		min = math.Min(min, joules[i])
+		max = math.Max(max, joules[i])
 	}
-	return math.MaxFloat64
+
+	// score every node relative to the coolest and warmest node
+	priorities := make(k8sSchedulerApi.HostPriorityList, 0, len(candidates))
+	for i, node := range candidates {
+		score := 0
+		switch {
+		case joules[i] == math.MaxFloat64:
+			// nodes without valid heat keep the lowest score
+		case max == min:
+			score = maxPriority
+		default:
+			score = int(math.Floor((max-joules[i])/(max-min)*maxPriority + 0.5))
+		}
+		priorities = append(priorities, k8sSchedulerApi.HostPriority{
+			Host:  node.Name,
+			Score: score,
+		})
+	}
+
+	return priorities, nil
 }
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"strconv"
 	"testing"
 
 	k8sApi "k8s.io/kubernetes/pkg/api"
 )
 
-// TestSelectNodeSuccess tests selectNode using different inputs.
-func TestSelectNodeSuccess(t *testing.T) {
+// TestFilterNodesCoolest tests filterNodes in coolest mode using different
+// inputs.
+func TestFilterNodesCoolest(t *testing.T) {
 	testCases := map[string]struct {
 		list     k8sApi.NodeList
 		expected string
@@ -52,10 +54,18 @@ func TestSelectNodeSuccess(t *testing.T) {
 			),
 			expected: "node1",
 		},
+		"nearly equal": {
+			list: newNodeList(
+				newNode("node1", "1000000.02"),
+				newNode("node2", "1000000.01"),
+			),
+			expected: "node2",
+		},
 	}
 
 	for desc, tc := range testCases {
-		nodes, err := selectNode(&tc.list)
+		c := defaultConfig()
+		nodes, _, err := filterNodes(c, readCandidates(c, tc.list.Items))
 		if err != nil {
 			t.Errorf("Error when testing case %v: %v", desc, err)
 		} else {
@@ -66,11 +76,96 @@ func TestSelectNodeSuccess(t *testing.T) {
 	}
 }
 
-// TestSelectNodeFail tests the case when selecting a node fails.
-func TestSelectNodeFail(t *testing.T) {
+// TestFilterNodesCoolestFail tests the case when selecting a node fails.
+func TestFilterNodesCoolestFail(t *testing.T) {
 	list := newNodeList()
-	_, err := selectNode(&list)
+	c := defaultConfig()
+	_, _, err := filterNodes(c, readCandidates(c, list.Items))
 	if err == nil {
 		t.Errorf("Expected error because list was empty")
 	}
 }
+
+// TestPrioritizeNodes tests prioritizeNodes using different inputs.
+func TestPrioritizeNodes(t *testing.T) {
+	testCases := map[string]struct {
+		list     k8sApi.NodeList
+		expected map[string]int
+	}{
+		"linear": {
+			list: newNodeList(
+				newNode("node1", "50"),
+				newNode("node2", "75"),
+				newNode("node3", "100"),
+			),
+			expected: map[string]int{"node1": 10, "node2": 5, "node3": 0},
+		},
+		"equal joules": {
+			list: newNodeList(
+				newNode("node1", "50"),
+				newNode("node2", "50"),
+			),
+			expected: map[string]int{"node1": 10, "node2": 10},
+		},
+		"illigal and missing joules": {
+			list: newNodeList(
+				newNode("node1", "55.5"),
+				newNode("node2", "illigal"),
+				newNode("node3", ""),
+			),
+			expected: map[string]int{"node1": 10, "node2": 0, "node3": 0},
+		},
+	}
+
+	for desc, tc := range testCases {
+		c := defaultConfig()
+		priorities, err := prioritizeNodes(c, readCandidates(c, tc.list.Items))
+		if err != nil {
+			t.Errorf("Error when testing case %v: %v", desc, err)
+			continue
+		}
+		if len(priorities) != len(tc.expected) {
+			t.Errorf("Test case %v: expected %v scores but got %v", desc, len(tc.expected), len(priorities))
+			continue
+		}
+		for _, hp := range priorities {
+			if hp.Score != tc.expected[hp.Host] {
+				t.Errorf("Test case %v: expected node %v to have score %v but got %v", desc, hp.Host, tc.expected[hp.Host], hp.Score)
+			}
+		}
+	}
+}
+
+// BenchmarkFilter measures reading the heat of 1k and 5k nodes and filtering
+// them for a pod, as the filter verb does.
+func BenchmarkFilter(b *testing.B) {
+	c := defaultConfig()
+	pod := newPod("web", nil, "500m")
+	for _, n := range []int{1000, 5000} {
+		list := newCluster(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := filterForPod(c, &pod, readCandidates(c, list.Items)); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPrioritizeNodes measures scoring 1k and 5k nodes.
+func BenchmarkPrioritizeNodes(b *testing.B) {
+	c := defaultConfig()
+	for _, n := range []int{1000, 5000} {
+		list := newCluster(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := prioritizeNodes(c, readCandidates(c, list.Items)); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
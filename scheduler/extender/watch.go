@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sUnversioned "k8s.io/kubernetes/pkg/api/unversioned"
+	k8sRestCl "k8s.io/kubernetes/pkg/client/restclient"
+	k8sClient "k8s.io/kubernetes/pkg/client/unversioned"
+	k8sFields "k8s.io/kubernetes/pkg/fields"
+	k8sLabels "k8s.io/kubernetes/pkg/labels"
+	k8sWatch "k8s.io/kubernetes/pkg/watch"
+)
+
+// watchRetry is the time a watcher waits before listing again after an
+// error.
+const watchRetry = 5 * time.Second
+
+// apiWatcher keeps a cache up to date by listing a resource with the
+// kubernetes client and watching it from the resource version of the list.
+// A watch that ends is resumed from the resource version of the last event,
+// the resource is only listed again after an error.
+type apiWatcher struct {
+	resource string // plural name of the watched resource, e.g. pods
+
+	// replace lists the resource into the cache and returns the resource
+	// version of the list.
+	replace func() (string, error)
+	// start starts a watch of the changes after a resource version.
+	start func(version string) (k8sWatch.Interface, error)
+	// apply applies an event to the cache and returns the resource version
+	// of its object.
+	apply func(event k8sWatch.Event) (string, error)
+}
+
+// newClient returns a kubernetes client of apiServer, or of the API server of
+// the cluster the extender runs in when apiServer is empty.
+func newClient(apiServer string) (*k8sClient.Client, error) {
+	if apiServer == "" {
+		client, err := k8sClient.NewInCluster()
+		if err != nil {
+			return nil, fmt.Errorf("could not create in-cluster client: %v", err)
+		}
+		return client, nil
+	}
+	client, err := k8sClient.New(&k8sRestCl.Config{Host: apiServer})
+	if err != nil {
+		return nil, fmt.Errorf("could not create client of %v: %v", apiServer, err)
+	}
+	return client, nil
+}
+
+// listAll returns the options listing every object of a resource, or
+// watching it from version when version is not empty.
+func listAll(version string) k8sApi.ListOptions {
+	return k8sApi.ListOptions{
+		LabelSelector:   k8sLabels.Everything(),
+		FieldSelector:   k8sFields.Everything(),
+		Watch:           version != "",
+		ResourceVersion: version,
+	}
+}
+
+// newPodWatcher returns a watcher that keeps cache up to date with the pods
+// on apiServer.
+func newPodWatcher(apiServer string, cache *podCache) (*apiWatcher, error) {
+	client, err := newClient(apiServer)
+	if err != nil {
+		return nil, err
+	}
+	pods := client.Pods(k8sApi.NamespaceAll)
+	return &apiWatcher{
+		resource: "pods",
+		replace: func() (string, error) {
+			list, err := pods.List(listAll(""))
+			if err != nil {
+				return "", err
+			}
+			cache.replace(list.Items)
+			return list.ResourceVersion, nil
+		},
+		start: func(version string) (k8sWatch.Interface, error) {
+			return pods.Watch(listAll(version))
+		},
+		apply: func(event k8sWatch.Event) (string, error) {
+			pod, ok := event.Object.(*k8sApi.Pod)
+			if !ok {
+				return "", fmt.Errorf("expected a pod but got %T", event.Object)
+			}
+			cache.update(pod, event.Type == k8sWatch.Deleted)
+			return pod.ResourceVersion, nil
+		},
+	}, nil
+}
+
+// newNodeWatcher returns a watcher that keeps cache up to date with the
+// nodes on apiServer.
+func newNodeWatcher(apiServer string, cache *nodeCache) (*apiWatcher, error) {
+	client, err := newClient(apiServer)
+	if err != nil {
+		return nil, err
+	}
+	nodes := client.Nodes()
+	return &apiWatcher{
+		resource: "nodes",
+		replace: func() (string, error) {
+			list, err := nodes.List(listAll(""))
+			if err != nil {
+				return "", err
+			}
+			cache.replace(list.Items)
+			return list.ResourceVersion, nil
+		},
+		start: func(version string) (k8sWatch.Interface, error) {
+			return nodes.Watch(listAll(version))
+		},
+		apply: func(event k8sWatch.Event) (string, error) {
+			node, ok := event.Object.(*k8sApi.Node)
+			if !ok {
+				return "", fmt.Errorf("expected a node but got %T", event.Object)
+			}
+			cache.update(node, event.Type == k8sWatch.Deleted)
+			return node.ResourceVersion, nil
+		},
+	}, nil
+}
+
+// run lists and watches the resource until stop is closed. A watch that ends
+// is resumed from the last resource version seen, after an error the
+// resource is listed again.
+func (w *apiWatcher) run(stop <-chan struct{}) {
+	version := ""
+	for {
+		var err error
+		if version == "" {
+			version, err = w.list()
+		}
+		if err == nil {
+			version, err = w.watch(version, stop)
+		}
+		wait := time.Duration(0)
+		if err != nil {
+			errorf("Watch of %v failed, listing %v again in %v: %v", w.resource, w.resource, watchRetry, err)
+			version, wait = "", watchRetry
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// list replaces the cache with all objects of the resource and returns the
+// resource version of the list.
+func (w *apiWatcher) list() (string, error) {
+	version, err := w.replace()
+	if err != nil {
+		return "", fmt.Errorf("could not list %v: %v", w.resource, err)
+	}
+	debugf("Listed %v at resource version %v", w.resource, version)
+	return version, nil
+}
+
+// watch applies the events after version to the cache until the watch ends,
+// fails or stop is closed. It returns the resource version of the last event,
+// from which the next watch continues.
+func (w *apiWatcher) watch(version string, stop <-chan struct{}) (string, error) {
+	watcher, err := w.start(version)
+	if err != nil {
+		return version, fmt.Errorf("could not watch %v: %v", w.resource, err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return version, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				// the API server ends every watch after a while.
+				return version, nil
+			}
+			if event.Type == k8sWatch.Error {
+				if status, ok := event.Object.(*k8sUnversioned.Status); ok {
+					return version, fmt.Errorf("watch of %v answered with error: %v", w.resource, status.Message)
+				}
+				return version, fmt.Errorf("watch of %v answered with error: %v", w.resource, event.Object)
+			}
+			next, err := w.apply(event)
+			if err != nil {
+				return version, fmt.Errorf("could not apply %v event of %v: %v", event.Type, w.resource, err)
+			}
+			version = next
+		}
+	}
+}
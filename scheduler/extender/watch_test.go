@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	k8sApi "k8s.io/kubernetes/pkg/api"
+	k8sUnversioned "k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// watchEvent returns a line of a watch answered by the API server, obj must
+// have a kind and version.
+func watchEvent(t *testing.T, typ string, obj interface{}) string {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Error marshalling %v: %v", obj, err)
+	}
+	return fmt.Sprintf(`{"type": %q, "object": %s}`, typ, b)
+}
+
+// versionedPod returns a bound pod with the kind, version and resource
+// version the API server sends.
+func versionedPod(name, node, version string, cpus ...string) *k8sApi.Pod {
+	pod := newBoundPod(name, node, cpus...)
+	pod.TypeMeta = k8sUnversioned.TypeMeta{Kind: "Pod", APIVersion: "v1"}
+	pod.ResourceVersion = version
+	return &pod
+}
+
+// versionedNode returns a node with the kind, version and resource version
+// the API server sends.
+func versionedNode(name, joules, version string) *k8sApi.Node {
+	node := newNode(name, joules)
+	node.TypeMeta = k8sUnversioned.TypeMeta{Kind: "Node", APIVersion: "v1"}
+	node.ResourceVersion = version
+	return &node
+}
+
+// TestPodWatcher tests that the watcher lists the pods and applies the
+// events of the watch to the cache.
+func TestPodWatcher(t *testing.T) {
+	watched := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			json.NewEncoder(w).Encode(&k8sApi.PodList{
+				TypeMeta: k8sUnversioned.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+				ListMeta: k8sUnversioned.ListMeta{ResourceVersion: "10"},
+				Items:    []k8sApi.Pod{*versionedPod("a", "node1", "8", "1"), *versionedPod("b", "node1", "9", "1")},
+			})
+		case "/api/v1/watch/pods":
+			watched <- r.URL.Query().Get("resourceVersion")
+			fmt.Fprintln(w, watchEvent(t, "ADDED", versionedPod("c", "node1", "11", "1")))
+			fmt.Fprintln(w, watchEvent(t, "MODIFIED", versionedPod("a", "node1", "12", "2")))
+			fmt.Fprintln(w, watchEvent(t, "DELETED", versionedPod("b", "node1", "13", "1")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cache := newPodCache()
+	w, err := newPodWatcher(srv.URL, cache)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	version, err := w.list()
+	if err != nil || version != "10" {
+		t.Fatalf("Expected resource version 10 but got %v (%v)", version, err)
+	}
+	version, err = w.watch(version, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v := <-watched; v != "10" {
+		t.Errorf("Expected the watch to start at resource version 10 but got %v", v)
+	}
+	if version != "13" {
+		t.Errorf("Expected the watch to end at resource version 13 but got %v", version)
+	}
+
+	node := newSizedNode("node1", "50", "4", "8Gi")
+	pod := newPod("new", nil)
+	if u, ok := cache.utilisation(&node, &pod); !ok || u != 0.75 {
+		t.Errorf("Expected utilisation 0.75 after the events but got %v (%v)", u, ok)
+	}
+}
+
+// TestPodWatcherErrors tests that failed lists and error events end the
+// watch with an error.
+func TestPodWatcherErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/v1/watch/pods" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprintln(w, watchEvent(t, "ERROR", &k8sUnversioned.Status{
+			TypeMeta: k8sUnversioned.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   k8sUnversioned.StatusFailure,
+			Message:  "too old resource version",
+			Code:     http.StatusGone,
+		}))
+	}))
+	defer srv.Close()
+
+	w, err := newPodWatcher(srv.URL, newPodCache())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := w.list(); err == nil {
+		t.Errorf("Expected an error listing pods without permission")
+	}
+	if _, err := w.watch("10", nil); err == nil {
+		t.Errorf("Expected an error on an error event")
+	}
+}
+
+// TestNodeWatcher tests that the node watcher lists the nodes and applies the
+// events of the watch to the node cache.
+func TestNodeWatcher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			json.NewEncoder(w).Encode(&k8sApi.NodeList{
+				TypeMeta: k8sUnversioned.TypeMeta{Kind: "NodeList", APIVersion: "v1"},
+				ListMeta: k8sUnversioned.ListMeta{ResourceVersion: "20"},
+				Items:    []k8sApi.Node{*versionedNode("node1", "50", "18"), *versionedNode("node2", "60", "19")},
+			})
+		case "/api/v1/watch/nodes":
+			fmt.Fprintln(w, watchEvent(t, "ADDED", versionedNode("node3", "70", "21")))
+			fmt.Fprintln(w, watchEvent(t, "MODIFIED", versionedNode("node1", "55", "22")))
+			fmt.Fprintln(w, watchEvent(t, "DELETED", versionedNode("node2", "60", "23")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cache := newNodeCache()
+	w, err := newNodeWatcher(srv.URL, cache)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	version, err := w.list()
+	if err != nil || version != "20" {
+		t.Fatalf("Expected resource version 20 but got %v (%v)", version, err)
+	}
+	if _, err := w.watch(version, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	nodes, err := cache.lookup([]string{"node1", "node2", "node3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"55", "", "70"}
+	for i, node := range nodes {
+		if node.Labels[defaultLabelKey] != expected[i] {
+			t.Errorf("Expected %v to have joules %q but got %q", node.Name, expected[i], node.Labels[defaultLabelKey])
+		}
+	}
+}
+
+// TestWatcherResume tests that run resumes an ended watch from the resource
+// version of the last event instead of listing again.
+func TestWatcherResume(t *testing.T) {
+	lists, watches := make(chan struct{}, 10), make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			select {
+			case lists <- struct{}{}:
+			default:
+			}
+			json.NewEncoder(w).Encode(&k8sApi.NodeList{
+				TypeMeta: k8sUnversioned.TypeMeta{Kind: "NodeList", APIVersion: "v1"},
+				ListMeta: k8sUnversioned.ListMeta{ResourceVersion: "30"},
+			})
+		case "/api/v1/watch/nodes":
+			version := r.URL.Query().Get("resourceVersion")
+			select {
+			case watches <- version:
+			default:
+			}
+			if version == "30" {
+				fmt.Fprintln(w, watchEvent(t, "ADDED", versionedNode("node1", "50", "31")))
+				fmt.Fprintln(w, watchEvent(t, "MODIFIED", versionedNode("node1", "55", "32")))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	w, err := newNodeWatcher(srv.URL, newNodeCache())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.run(stop)
+		close(done)
+	}()
+	for _, expected := range []string{"30", "32"} {
+		if v := <-watches; v != expected {
+			t.Errorf("Expected a watch from resource version %v but got %v", expected, v)
+		}
+	}
+	close(stop)
+	<-done
+	if n := len(lists); n != 1 {
+		t.Errorf("Expected the nodes to be listed once but got %v lists", n)
+	}
+}